@@ -0,0 +1,221 @@
+package confusing
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type acronymTable struct {
+	// words are kept as a single word when normalizing keys, sorted from the longest to the shortest so that HTTPS wins over HTTP
+	words []string
+	// spellings maps the lowercase form of every acronym to its spelling, to restore it in camelCase keys
+	spellings map[string]string
+	// initials holds the first byte of every word, so that most positions of a key are skipped without comparing words
+	initials [256]bool
+}
+
+// builtinAcronyms are registered in every registry
+var builtinAcronyms = []string{
+	"API", "CPU", "DB", "DNS", "GRPC", "HTML", "HTTP", "HTTPS", "ID", "IP", "JSON", "JWT", "OAuth", "SQL",
+	"SSH", "SSL", "TCP", "TLS", "TTL", "UDP", "UI", "URI", "URL", "UUID", "XML", "YAML",
+}
+
+// RegisterAcronyms adds words which are kept together when normalizing keys in the default registry
+func RegisterAcronyms(words ...string) {
+	defaultRegistry.RegisterAcronyms(words...)
+}
+
+// RegisterAcronyms adds words which are kept together when normalizing keys, spelled as they appear in field names (e.g. OAuth)
+func (r *Registry) RegisterAcronyms(words ...string) {
+	r.acronymsMutex.Lock()
+	defer r.acronymsMutex.Unlock()
+
+	table := &acronymTable{spellings: make(map[string]string)}
+
+	if current := r.acronyms.Load(); current != nil {
+		table.words = slices.Clone(current.words)
+		table.spellings = maps.Clone(current.spellings)
+	}
+
+	for _, word := range words {
+		if len(word) == 0 {
+			continue
+		}
+
+		if _, ok := table.spellings[strings.ToLower(word)]; !ok {
+			table.words = append(table.words, word)
+		}
+
+		table.spellings[strings.ToLower(word)] = word
+	}
+
+	sort.SliceStable(table.words, func(i, j int) bool {
+		return len(table.words[i]) > len(table.words[j])
+	})
+
+	for _, word := range table.words {
+		table.initials[word[0]] = true
+	}
+
+	// the keys memoized by the normalizers are tied to the table they were normalized with, so only the plans are reset
+	r.acronyms.Store(table)
+	r.resetPlans()
+}
+
+// acronymAt returns the acronym starting at index i of s, which must start and end at word boundaries
+// e.g. ID is matched in UserID, IDs and ID2, but not in IDLE or Identity
+func (t *acronymTable) acronymAt(s string, i int) string {
+	if i > 0 && unicode.IsUpper(rune(s[i-1])) {
+		return ""
+	}
+
+	return t.matchAcronym(s, i)
+}
+
+// matchAcronym returns the acronym starting at index i of s if it ends at a word boundary
+func (t *acronymTable) matchAcronym(s string, i int) string {
+	if i >= len(s) || !t.initials[s[i]] {
+		return ""
+	}
+
+	for _, acronym := range t.words {
+		if !strings.HasPrefix(s[i:], acronym) {
+			continue
+		}
+
+		end := i + len(acronym)
+
+		// plurals such as IDs
+		if end < len(s) && s[end] == 's' && (end+1 == len(s) || !unicode.IsLower(rune(s[end+1]))) {
+			end++
+		}
+
+		if end == len(s) || t.isWordBoundary(s, end) {
+			return s[i:end]
+		}
+	}
+
+	return ""
+}
+
+// isWordBoundary tells whether a new word starts at index i of s, right after an acronym
+func (t *acronymTable) isWordBoundary(s string, i int) bool {
+	r := rune(s[i])
+
+	if !unicode.IsLetter(r) {
+		return true
+	}
+
+	if !unicode.IsUpper(r) {
+		return false
+	}
+
+	// either a capitalized word (HTTPServer) or another acronym (XMLHTTPRequest)
+	return (i+1 < len(s) && unicode.IsLower(rune(s[i+1]))) || len(t.matchAcronym(s, i)) > 0
+}
+
+// titleAcronyms capitalizes the acronyms of a key like regular words (e.g. OAuth2Providers becomes Oauth2Providers),
+// so that they are split like any other word
+// The key is returned as is when it doesn't contain any acronym
+func (t *acronymTable) titleAcronyms(key string) string {
+	var b strings.Builder
+
+	afterAcronym := false
+	changed := false
+
+	for i := 0; i < len(key); {
+		var acronym string
+
+		if afterAcronym {
+			acronym = t.matchAcronym(key, i)
+		} else {
+			acronym = t.acronymAt(key, i)
+		}
+
+		afterAcronym = len(acronym) > 0
+
+		if afterAcronym {
+			end := i + len(acronym)
+
+			if !changed {
+				b.Grow(len(key))
+				b.WriteString(key[:i])
+				changed = true
+			}
+
+			// acronyms which are already separate words (e.g. USER_ID) are kept as they are, since they would be split again
+			if i > 0 && isSeparator(key[i-1]) && (end == len(key) || !unicode.IsLetter(rune(key[end]))) {
+				b.WriteString(acronym)
+			} else {
+				b.WriteString(ucfirst(strings.ToLower(acronym)))
+			}
+
+			i = end
+
+			continue
+		}
+
+		if changed {
+			b.WriteByte(key[i])
+		}
+
+		i++
+	}
+
+	if !changed {
+		return key
+	}
+
+	return b.String()
+}
+
+// isSeparator tells whether a character separates the words of a key
+func isSeparator(c byte) bool {
+	return c == '_' || c == '-' || c == '.'
+}
+
+// lcfirstWord lowercases the first word of a key, which may be an acronym or a run of capitals (e.g. HTTPServer becomes httpServer)
+func (t *acronymTable) lcfirstWord(key string) string {
+	if acronym := t.acronymAt(key, 0); len(acronym) > 0 {
+		return strings.ToLower(acronym) + key[len(acronym):]
+	}
+
+	end := 0
+
+	for end < len(key) && unicode.IsUpper(rune(key[end])) {
+		end++
+	}
+
+	// the last capital of a run starts the next word, unless the run ends the key or is followed by a digit
+	if end > 1 && end < len(key) && unicode.IsLower(rune(key[end])) {
+		end--
+	}
+
+	if end <= 1 {
+		return lcfirst(key)
+	}
+
+	return strings.ToLower(key[:end]) + key[end:]
+}
+
+// acronymSpelling returns the spelling of a lowercase word if it's an acronym, ignoring trailing digits and plurals
+// e.g. oauth2 is spelled OAuth2, and ids IDs
+func (t *acronymTable) acronymSpelling(word string) (string, bool) {
+	stem := strings.TrimRightFunc(word, unicode.IsDigit)
+	suffix := word[len(stem):]
+
+	if spelling, ok := t.spellings[stem]; ok {
+		return spelling + suffix, true
+	}
+
+	if strings.HasSuffix(stem, "s") {
+		if spelling, ok := t.spellings[strings.TrimSuffix(stem, "s")]; ok {
+			return spelling + "s" + suffix, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,146 @@
+package confusing
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Logger receives the warnings of sources, such as the use of deprecated keys, and is satisfied by *slog.Logger
+type Logger interface {
+	Warn(msg string, args ...any)
+}
+
+// SetLogger replaces the logger warnings of the default registry are written to
+func SetLogger(l Logger) {
+	defaultRegistry.SetLogger(l)
+}
+
+// SetLogger replaces the logger warnings are written to, which defaults to slog.Default(), or discards them if it's nil
+func (r *Registry) SetLogger(l Logger) {
+	r.loggerMutex.Lock()
+	defer r.loggerMutex.Unlock()
+
+	r.logger = l
+}
+
+func (r *Registry) warnDeprecatedKey(alias string, key string) {
+	r.loggerMutex.RLock()
+	defer r.loggerMutex.RUnlock()
+
+	if r.logger != nil {
+		r.logger.Warn("deprecated config key", "key", alias, "replacement", key)
+	}
+}
+
+// RegisterAlias registers an alias in the default registry
+func RegisterAlias(key string, alias string) {
+	defaultRegistry.RegisterAlias(key, alias)
+}
+
+// RegisterAlias reads key from alias when it's not set, logging a deprecation warning, like the alias option of the config tag
+// Both keys are absolute, and are normalized by each source like the keys given to ReadKey
+func (r *Registry) RegisterAlias(key string, alias string) {
+	r.aliasesMutex.Lock()
+	defer r.aliasesMutex.Unlock()
+
+	r.aliases[key] = append(r.aliases[key], alias)
+	r.resetAliasTables()
+}
+
+// registeredAliases returns the aliases registered for a key which is already normalized
+func (r *Registry) registeredAliases(normalizer KeyNormalizer, key string) []string {
+	return r.aliasTableFor(normalizer).aliases[key]
+}
+
+// hasRegisteredAliasesUnder tells whether aliases are registered for keys nested under a key which is already normalized
+func (r *Registry) hasRegisteredAliasesUnder(normalizer KeyNormalizer, key string) bool {
+	_, ok := r.aliasTableFor(normalizer).parents[key]
+
+	return ok
+}
+
+// AliasConflictError is returned when a key and one of its deprecated aliases are both set to different values
+type AliasConflictError struct {
+	Key   string
+	Alias string
+}
+
+func (a AliasConflictError) Error() string {
+	return fmt.Sprintf("%s and its deprecated alias %s are set to different values", a.Key, a.Alias)
+}
+
+// parseConfigTag splits a config tag such as "timeout,alias=request_timeout" into the key and its aliases
+func parseConfigTag(tag string) (string, []string) {
+	key, options, _ := strings.Cut(tag, ",")
+
+	var tagAliases []string
+
+	for _, option := range strings.Split(options, ",") {
+		if alias, ok := strings.CutPrefix(strings.TrimSpace(option), "alias="); ok && len(alias) > 0 {
+			tagAliases = append(tagAliases, alias)
+		}
+	}
+
+	return key, tagAliases
+}
+
+// fieldAliases returns the aliases given to a field by the config tag, which are relative to its parent like its key
+func fieldAliases(field reflect.StructField) []string {
+	_, tagAliases := parseConfigTag(field.Tag.Get("config"))
+
+	return tagAliases
+}
+
+// resolveAliases falls back to the aliases of a field when its key isn't set, or checks that they don't conflict with it
+// key is the absolute key of the field, fieldAliases are relative to its parent, and the absolute keys of the aliases
+// which are set are added to found
+func (s *MapSource) resolveAliases(m map[string]interface{}, parentKey string, fieldAliases []string, key string, value interface{}, found map[string]struct{}) (interface{}, string, error) {
+	type alias struct {
+		value interface{}
+		key   string
+	}
+
+	var set []alias
+
+	for _, fieldAlias := range fieldAliases {
+		aliasValue, aliasKey, ok, err := s.resolveKey(m, parentKey, fieldAlias)
+
+		if err != nil {
+			return nil, key, err
+		}
+
+		if ok {
+			set = append(set, alias{aliasValue, concatenateKeys(parentKey, aliasKey)})
+		}
+	}
+
+	for _, registeredAlias := range s.registry.registeredAliases(s.normalizer, key) {
+		aliasValue, aliasKey, ok, err := s.resolveKey(s.data, "", registeredAlias)
+
+		if err != nil {
+			return nil, key, err
+		}
+
+		if ok {
+			set = append(set, alias{aliasValue, aliasKey})
+		}
+	}
+
+	// the value read from an alias is reported under the key of the alias
+	valueKey := key
+
+	for _, a := range set {
+		found[a.key] = struct{}{}
+
+		if value == nil {
+			value, valueKey = a.value, a.key
+		} else if !reflect.DeepEqual(value, a.value) {
+			return nil, key, AliasConflictError{Key: key, Alias: a.key}
+		}
+
+		s.registry.warnDeprecatedKey(a.key, key)
+	}
+
+	return value, valueKey, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Pyrodash/confusing"
+	"os"
+)
+
+func runConvert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := flags.String("from", "", "type of the input file (yaml, json, toml or env), inferred from its extension by default")
+	to := flags.String("to", "", "type of the output file (yaml, json, toml or env), inferred from the extension of -o by default")
+	convention := flags.String("convention", "", "convention of the output keys, defaults to the convention of the output type")
+	schemaPath := flags.String("schema", "", "JSON schema used to nest the variables of an env file, which are kept flat otherwise, and to write maps as JSON variables")
+	output := flags.String("o", "", "path to the output file, defaults to the standard output")
+
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: confusing convert [-from type] [-to type] [-convention name] [-schema schema.json] [-o output] input")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+
+		return 2
+	}
+
+	targetType := *to
+
+	if targetType == "" && *output != "" {
+		targetType = confusing.SourceTypeForFile(*output)
+	}
+
+	if targetType == "" {
+		fmt.Fprintln(os.Stderr, "the output type must be specified with -to when it can't be inferred from -o")
+
+		return 2
+	}
+
+	var schema *confusing.Schema
+	var err error
+
+	if *schemaPath != "" {
+		schema, err = readSchema(*schemaPath)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read schema: %s\n", err)
+
+			return 2
+		}
+	}
+
+	doc, err := confusing.ReadDocument(flags.Arg(0), *from)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+
+		return 1
+	}
+
+	converted, err := doc.Convert(targetType, *convention, schema)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	data, err := converted.Encode()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0644)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Pyrodash/confusing"
+	"os"
+)
+
+// runDiff exits with 1 when the files differ, and with 2 when they can't be compared
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	oldType := flags.String("old-type", "", "type of the old file (yaml, json, toml or env), inferred from its extension by default")
+	newType := flags.String("new-type", "", "type of the new file (yaml, json, toml or env), inferred from its extension by default")
+	schemaPath := flags.String("schema", "", "JSON schema used to nest the variables of env files and to find the secret keys")
+
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: confusing diff [-old-type type] [-new-type type] [-schema schema.json] old new")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+
+		return 2
+	}
+
+	var schema *confusing.Schema
+	var err error
+
+	if *schemaPath != "" {
+		schema, err = readSchema(*schemaPath)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read schema: %s\n", err)
+
+			return 2
+		}
+	}
+
+	oldDoc, err := confusing.ReadDocument(flags.Arg(0), *oldType)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+
+		return 2
+	}
+
+	newDoc, err := confusing.ReadDocument(flags.Arg(1), *newType)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(1), err)
+
+		return 2
+	}
+
+	changes, err := confusing.Diff(oldDoc, newDoc, schema)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 2
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	if len(changes) > 0 {
+		return 1
+	}
+
+	return 0
+}
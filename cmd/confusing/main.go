@@ -0,0 +1,46 @@
+// Command confusing works with config files outside of the application reading them
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{"validate", "validate config files against a JSON schema generated from a config struct", runValidate},
+	{"convert", "convert a config file to another format, re-normalizing its keys", runConvert},
+	{"diff", "compare two config files, which may be of different formats", runDiff},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: confusing <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
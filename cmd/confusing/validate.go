@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Pyrodash/confusing"
+	"os"
+)
+
+// runValidate exits with 1 when any of the files is invalid, and with 2 when the files can't be read
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	schemaPath := flags.String("schema", "", "path to the JSON schema generated by confusing.GenerateJSONSchema")
+	sourceType := flags.String("type", "", "type of the config files (yaml, json or env), inferred from their extension by default")
+
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: confusing validate -schema schema.json [-type yaml|json|env] file...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *schemaPath == "" || flags.NArg() == 0 {
+		flags.Usage()
+
+		return 2
+	}
+
+	schema, err := readSchema(*schemaPath)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read schema: %s\n", err)
+
+		return 2
+	}
+
+	status := 0
+
+	for _, file := range flags.Args() {
+		doc, err := confusing.ReadDocument(file, *sourceType)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			status = 2
+
+			continue
+		}
+
+		errs, err := doc.Validate(schema)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			status = 2
+
+			continue
+		}
+
+		for _, validationErr := range errs {
+			fmt.Println(validationErr)
+		}
+
+		if len(errs) > 0 && status == 0 {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func readSchema(path string) (*confusing.Schema, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schema confusing.Schema
+
+	if err = json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
@@ -1,86 +1,101 @@
 package confusing
 
 import (
+	"context"
 	"errors"
-	"os"
 	"reflect"
-	"strings"
 )
 
 var (
 	InvalidBooleanError = errors.New("invalid boolean value")
 	readerType          = reflect.TypeOf((*Reader)(nil)).Elem()
+	contextReaderType   = reflect.TypeOf((*ContextReader)(nil)).Elem()
 )
 
-var sources = map[SourceType]SourceBuilder{
-	EnvSourceType:  BuildEnvSource,
-	YAMLSourceType: BuildYAMLSource,
-	JSONSourceType: BuildJSONSource,
+var builtinSources = map[SourceType]ContextSourceBuilder{
+	EnvSourceType:    withContext(BuildEnvSource),
+	YAMLSourceType:   withContext(BuildYAMLSource),
+	JSONSourceType:   withContext(BuildJSONSource),
+	TOMLSourceType:   withContext(BuildTOMLSource),
+	HTTPSourceType:   BuildHTTPSourceContext,
+	ConsulSourceType: BuildConsulSourceContext,
+	VaultSourceType:  BuildVaultSourceContext,
+	EtcdSourceType:   BuildEtcdSourceContext,
 }
 
-var sourceTypeByExt = map[string]SourceType{
+var builtinSourceTypeByExt = map[string]SourceType{
 	".yaml": YAMLSourceType,
 	".yml":  YAMLSourceType,
 	".json": JSONSourceType,
+	".toml": TOMLSourceType,
 	".env":  EnvSourceType,
 }
 
+// Remote sources are inferred from the scheme of their URL
+var builtinSourceTypeByScheme = map[string]SourceType{
+	"http":   HTTPSourceType,
+	"https":  HTTPSourceType,
+	"consul": ConsulSourceType,
+	"vault":  VaultSourceType,
+	"etcd":   EtcdSourceType,
+}
+
 // User-registered sources are always attempted before pre-existing sources (hence why they are reversed)
+// Remote sources are never attempted unless their type is specified or inferred from the file path
 // EnvSource is always attempted last because it always succeeds (unless a .env file is explicitly specified and fails to be read)
-var reverseOrderedSources = []string{"env", "json", "yaml"}
+var builtinReverseOrderedSources = []SourceType{"env", "toml", "json", "yaml"}
 
 type Reader interface {
 	ReadConfig(source Source) error
 }
 
-func RegisterSource(typ string, builder SourceBuilder) {
-	sources[typ] = builder
-	sourceTypeByExt["."+typ] = typ
-	reverseOrderedSources = append(reverseOrderedSources, typ)
+// ContextReader is like Reader, for types which need the context the config is read with
+// It takes precedence over Reader when a type implements both
+type ContextReader interface {
+	ReadConfigContext(ctx context.Context, source Source) error
 }
 
-type Options struct {
-	SourceOptions SourceOptions
-	SourceType    SourceType
+// isCustomReader tells whether a type (or a pointer to it) decides on its own how it's read
+func isCustomReader(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(readerType) || reflect.PointerTo(t).Implements(contextReaderType)
 }
 
-func NewSource(optsSlice ...Options) (Source, error) {
-	sourceOptions := SourceOptions{
-		FilePath:   os.Getenv("CONFIG_PATH"),
-		Convention: os.Getenv("CONFIG_CONVENTION"),
+// readCustom reads a custom reader from source, preferring ReadConfigContext, and reports whether target is one
+func readCustom(ctx context.Context, target reflect.Value, source Source) (bool, error) {
+	switch reader := target.Interface().(type) {
+	case ContextReader:
+		return true, reader.ReadConfigContext(ctx, source)
+	case Reader:
+		return true, reader.ReadConfig(source)
 	}
 
-	sourceType := strings.ToLower(os.Getenv("CONFIG_TYPE"))
-	subsetSources := reverseOrderedSources
-
-	if len(optsSlice) > 0 {
-		sourceOptions.FilePath = stringOrDefault(sourceOptions.FilePath, optsSlice[0].SourceOptions.FilePath)
-		sourceOptions.Convention = stringOrDefault(sourceOptions.Convention, optsSlice[0].SourceOptions.Convention)
-		sourceType = stringOrDefault(sourceType, optsSlice[0].SourceType)
-	}
+	return false, nil
+}
 
-	if len(sourceType) > 0 {
-		subsetSources = []SourceType{sourceType}
-	} else if len(sourceOptions.FilePath) > 0 {
-		inferredType := inferSourceTypeFromFilePath(sourceOptions.FilePath)
+func RegisterSource(typ string, builder SourceBuilder) {
+	defaultRegistry.RegisterSource(typ, builder)
+}
 
-		if len(inferredType) > 0 {
-			subsetSources = []SourceType{inferredType}
-		}
-	}
+// RegisterSourceContext is like RegisterSource, for builders which take the context given to NewSourceContext
+func RegisterSourceContext(typ string, builder ContextSourceBuilder) {
+	defaultRegistry.RegisterSourceContext(typ, builder)
+}
 
-	var source Source
-	var err error
+type Options struct {
+	SourceOptions SourceOptions
+	SourceType    SourceType
+}
 
-	for i := len(subsetSources) - 1; i >= 0; i-- {
-		typ := subsetSources[i]
-		builder := sources[typ]
-		source, err = builder(sourceOptions)
+// NewSource acquires a source using the default registry
+func NewSource(optsSlice ...Options) (Source, error) {
+	return NewSourceContext(context.Background(), optsSlice...)
+}
 
-		if err == nil {
-			return source, nil
-		}
+// NewSourceContext is like NewSource, giving up on remote sources once ctx is done
+func NewSourceContext(ctx context.Context, optsSlice ...Options) (Source, error) {
+	if len(optsSlice) > 0 && optsSlice[0].SourceOptions.Registry != nil {
+		return optsSlice[0].SourceOptions.Registry.NewSourceContext(ctx, optsSlice...)
 	}
 
-	return nil, err
+	return defaultRegistry.NewSourceContext(ctx, optsSlice...)
 }
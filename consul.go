@@ -0,0 +1,321 @@
+package confusing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ConsulSourceType SourceType = "consul"
+
+const defaultConsulWaitTime = 5 * time.Minute
+
+type ConsulSourceOptions struct {
+	// Address of the Consul HTTP API, defaulting to http://127.0.0.1:8500
+	Address    string
+	Prefix     string
+	Token      string
+	Datacenter string
+	Convention string
+	Strict     bool
+	FuzzyKeys  bool
+	// Registry resolves the convention of the keys stored under the prefix (DefaultRegistry when it's nil)
+	Registry *Registry
+	// Client mustn't time out before WaitTime, since the server holds blocking queries until then
+	Client *http.Client
+	// WaitTime is the longest a blocking query made by Watch waits for a change, defaulting to 5 minutes
+	WaitTime time.Duration
+}
+
+// kvPair is a key of a key-value store along with its raw value
+type kvPair struct {
+	Key   string
+	Value []byte
+}
+
+// ConsulSource reads the keys stored under a prefix of Consul's KV store, nesting them by splitting their paths on slashes
+// Values are decoded as YAML (and therefore JSON) when possible, so that numbers, booleans and lists keep their types
+type ConsulSource struct {
+	remoteSource
+	opts   ConsulSourceOptions
+	client *http.Client
+	// held while fetching, since the index is updated along with the data
+	fetching sync.Mutex
+	index    uint64
+}
+
+// prefix returns the folder holding the keys, ending with a slash so that sibling keys sharing its name aren't read
+func (s *ConsulSource) prefix() string {
+	prefix := strings.Trim(s.opts.Prefix, "/")
+
+	if len(prefix) == 0 {
+		return ""
+	}
+
+	return prefix + "/"
+}
+
+// Fetch reads the prefix, blocking for up to wait until it changes if wait is positive, and reports whether it changed
+func (s *ConsulSource) Fetch(ctx context.Context, wait time.Duration) (bool, error) {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	query := url.Values{"recurse": {"true"}}
+
+	if len(s.opts.Datacenter) > 0 {
+		query.Set("dc", s.opts.Datacenter)
+	}
+
+	if wait > 0 && s.index > 0 {
+		query.Set("index", strconv.FormatUint(s.index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/kv/%s?%s", strings.TrimRight(s.opts.Address, "/"), s.prefix(), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(s.opts.Token) > 0 {
+		req.Header.Set("X-Consul-Token", s.opts.Token)
+	}
+
+	res, err := s.client.Do(req)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer res.Body.Close()
+
+	var pairs []kvPair
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		if err = json.NewDecoder(res.Body).Decode(&pairs); err != nil {
+			return false, err
+		}
+	case http.StatusNotFound:
+		// the prefix holds no keys
+	default:
+		return false, fmt.Errorf("consul: unexpected status %s", res.Status)
+	}
+
+	// a missing or invalid index is 0, which can't be blocked on
+	index, _ := strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+
+	// blocking queries may return before anything changed
+	if index > 0 && index == s.index {
+		return false, nil
+	}
+
+	tree := kvTree(s.prefix(), pairs)
+
+	// without an index, changes are detected by comparing the keys
+	if index == 0 {
+		s.index = 0
+
+		if current := s.source(); current != nil && reflect.DeepEqual(current.data, tree) {
+			return false, nil
+		}
+	}
+
+	source, err := newMapSource(s.registry, ConsulSourceType, tree, s.opts.Convention)
+
+	if err != nil {
+		return false, err
+	}
+
+	source.strict = s.opts.Strict
+	source.fuzzy = s.opts.FuzzyKeys
+
+	s.swap(source)
+
+	// the index must be reset when it goes backwards, as stated by the Consul documentation
+	if index < s.index {
+		index = 0
+	}
+
+	s.index = index
+
+	return true, nil
+}
+
+// blocking tells whether the next query blocks until the prefix changes, which requires the index of the last response
+func (s *ConsulSource) blocking() bool {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	return s.index > 0
+}
+
+// Watch uses blocking queries to be notified of changes as soon as they happen
+func (s *ConsulSource) Watch(ctx context.Context, onChange func(err error)) error {
+	wait := s.opts.WaitTime
+
+	if wait <= 0 {
+		wait = defaultConsulWaitTime
+	}
+
+	for {
+		changed, err := s.Fetch(ctx, wait)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil || changed {
+			onChange(err)
+		}
+
+		// queries don't block without an index, so they're spaced out like when the server is failing
+		if err != nil || !s.blocking() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// kvTree nests the pairs found under the prefix folder by splitting their keys on slashes
+// A key holding a value is replaced by a map when other keys are nested under it
+func kvTree(prefix string, pairs []kvPair) map[string]interface{} {
+	tree := make(map[string]interface{})
+
+	if len(prefix) > 0 && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	for _, pair := range pairs {
+		// keys sharing the name of the folder (e.g. services/api-v2 for services/api) aren't part of it
+		if !strings.HasPrefix(pair.Key, prefix) {
+			continue
+		}
+
+		key := strings.Trim(strings.TrimPrefix(pair.Key, prefix), "/")
+
+		// folders are stored as keys ending with a slash and don't hold a value
+		if key == "" || strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+
+		setTreeValue(tree, strings.Split(key, "/"), decodeKVValue(pair.Value))
+	}
+
+	return tree
+}
+
+// setTreeValue stores value at the path, creating the intermediate maps as needed
+func setTreeValue(tree map[string]interface{}, path []string, value interface{}) {
+	m := tree
+
+	for _, part := range path[:len(path)-1] {
+		child, ok := m[part].(map[string]interface{})
+
+		if !ok {
+			child = make(map[string]interface{})
+			m[part] = child
+		}
+
+		m = child
+	}
+
+	last := path[len(path)-1]
+
+	if _, isMap := m[last].(map[string]interface{}); !isMap {
+		m[last] = value
+	}
+}
+
+// decodeKVValue decodes a value stored in a key-value store as YAML, falling back to the raw string
+func decodeKVValue(raw []byte) interface{} {
+	var value interface{}
+
+	if err := yaml.Unmarshal(raw, &value); err != nil || value == nil {
+		return string(raw)
+	}
+
+	return value
+}
+
+// NewConsulSource is like NewConsulSourceContext, without a deadline for the first fetch
+func NewConsulSource(opts ConsulSourceOptions) (*ConsulSource, error) {
+	return NewConsulSourceContext(context.Background(), opts)
+}
+
+// NewConsulSourceContext reads the prefix once, failing if it can't be read
+func NewConsulSourceContext(ctx context.Context, opts ConsulSourceOptions) (*ConsulSource, error) {
+	if len(opts.Address) == 0 {
+		opts.Address = "http://127.0.0.1:8500"
+	}
+
+	client := opts.Client
+
+	// no timeout, since blocking queries are held by the server for up to WaitTime
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	source := &ConsulSource{
+		remoteSource: remoteSource{typ: ConsulSourceType, registry: registryOrDefault(opts.Registry)},
+		opts:         opts,
+		client:       client,
+	}
+
+	if _, err := source.Fetch(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// BuildConsulSource is like BuildConsulSourceContext, without a deadline for the first fetch
+func BuildConsulSource(opts SourceOptions) (Source, error) {
+	return BuildConsulSourceContext(context.Background(), opts)
+}
+
+// BuildConsulSourceContext reads the address and the prefix from a file path such as consul://127.0.0.1:8500/services/api,
+// and the token from CONSUL_HTTP_TOKEN. CONSUL_HTTP_SSL=true switches to HTTPS
+func BuildConsulSourceContext(ctx context.Context, opts SourceOptions) (Source, error) {
+	u, err := url.Parse(opts.FilePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != ConsulSourceType {
+		return nil, errors.New("the file path of a consul source must be a consul:// URL")
+	}
+
+	scheme := "http"
+
+	// parsed the way Consul's own tools parse it
+	if ssl, _ := strconv.ParseBool(os.Getenv("CONSUL_HTTP_SSL")); ssl {
+		scheme = "https"
+	}
+
+	return NewConsulSourceContext(ctx, ConsulSourceOptions{
+		Address:    fmt.Sprintf("%s://%s", scheme, u.Host),
+		Prefix:     u.Path,
+		Token:      os.Getenv("CONSUL_HTTP_TOKEN"),
+		Datacenter: u.Query().Get("dc"),
+		Convention: opts.Convention,
+		Strict:     opts.Strict,
+		FuzzyKeys:  opts.FuzzyKeys,
+		Registry:   opts.Registry,
+	})
+}
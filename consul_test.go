@@ -0,0 +1,347 @@
+package confusing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// consulTestServer serves a KV store the way Consul does, matching keys by raw prefix and holding blocking queries
+type consulTestServer struct {
+	mutex sync.Mutex
+	pairs []kvPair
+	index uint64
+	// closed when the store changes
+	changed chan struct{}
+	// queries received by the server, without the blocking parameters
+	queries []string
+	// omits the X-Consul-Index header, like some proxies do
+	omitIndex bool
+}
+
+func newConsulTestServer(pairs map[string]string) *consulTestServer {
+	s := &consulTestServer{index: 1, changed: make(chan struct{})}
+	s.set(pairs)
+
+	return s
+}
+
+func (s *consulTestServer) set(pairs map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pairs = nil
+
+	for key, value := range pairs {
+		s.pairs = append(s.pairs, kvPair{Key: key, Value: []byte(value)})
+	}
+
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *consulTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mutex.Lock()
+	index, changed := s.index, s.changed
+	s.queries = append(s.queries, r.URL.Path+"?dc="+query.Get("dc")+"&token="+r.Header.Get("X-Consul-Token"))
+	s.mutex.Unlock()
+
+	if query.Get("index") == strconv.FormatUint(index, 10) {
+		wait, _ := time.ParseDuration(query.Get("wait"))
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var pairs []kvPair
+
+	for _, pair := range s.pairs {
+		if strings.HasPrefix(pair.Key, strings.TrimPrefix(r.URL.Path, "/v1/kv/")) {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	if !s.omitIndex {
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	}
+
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func (s *consulTestServer) lastQuery() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.queries[len(s.queries)-1]
+}
+
+func (s *consulTestServer) queryCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queries)
+}
+
+type consulTestConfig struct {
+	Host    string
+	Port    int
+	Tags    []string
+	Limits  map[string]int
+	Enabled bool
+}
+
+func TestConsulSourceFetch(t *testing.T) {
+	handler := newConsulTestServer(map[string]string{
+		"services/api/":             "",
+		"services/api/host":         "api.internal",
+		"services/api/port":         "8080",
+		"services/api/tags":         `["a", "b"]`,
+		"services/api/limits/rps":   "100",
+		"services/api/enabled":      "true",
+		"services/api-v2/port":      "9090",
+		"services/api-v2/unrelated": "x",
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "/services/api", Token: "token", Datacenter: "dc1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if query := handler.lastQuery(); query != "/v1/kv/services/api/?dc=dc1&token=token" {
+		t.Errorf("unexpected query %s", query)
+	}
+
+	var config consulTestConfig
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := consulTestConfig{Host: "api.internal", Port: 8080, Tags: []string{"a", "b"}, Limits: map[string]int{"rps": 100}, Enabled: true}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+
+	if keys := source.Keys(""); !reflect.DeepEqual(keys, []string{"enabled", "host", "limits", "port", "tags"}) {
+		t.Errorf("expected the keys of services/api only, got %v", keys)
+	}
+}
+
+func TestConsulSourceEmptyPrefix(t *testing.T) {
+	server := httptest.NewServer(newConsulTestServer(nil))
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "services/missing"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := source.Keys(""); len(keys) > 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+func TestConsulSourceBlockingQuery(t *testing.T) {
+	handler := newConsulTestServer(map[string]string{"app/port": "8080"})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "app"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the query is held until it times out, since nothing changed
+	start := time.Now()
+	changed, err := source.Fetch(context.Background(), time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed || time.Since(start) < time.Second {
+		t.Errorf("expected the query to block until it timed out without changes, changed: %v after %s", changed, time.Since(start))
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		handler.set(map[string]string{"app/port": "9090"})
+	}()
+
+	if changed, err = source.Fetch(context.Background(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var port int
+
+	if err = source.ReadKey("port", &port); err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || port != 9090 {
+		t.Errorf("expected the query to return as soon as the prefix changed, changed: %v, port: %d", changed, port)
+	}
+}
+
+func TestConsulSourceWatch(t *testing.T) {
+	handler := newConsulTestServer(map[string]string{"app/port": "8080"})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "app", WaitTime: time.Minute})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := make(chan error, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- source.Watch(ctx, func(err error) {
+			changes <- err
+		})
+	}()
+
+	handler.set(map[string]string{"app/port": "9090"})
+
+	select {
+	case err = <-changes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the change wasn't reported")
+	}
+
+	var port int
+
+	if err = source.ReadKey("port", &port); err != nil {
+		t.Fatal(err)
+	}
+
+	if port != 9090 {
+		t.Errorf("expected 9090, got %d", port)
+	}
+
+	// the blocking query in progress is abandoned
+	cancel()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to return context.Canceled, got %v", err)
+	}
+}
+
+func TestConsulSourceIndexReset(t *testing.T) {
+	handler := newConsulTestServer(map[string]string{"app/port": "8080"})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "app"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index went backwards, e.g. after the cluster was restored from a snapshot
+	handler.mutex.Lock()
+	handler.index = 1
+	handler.mutex.Unlock()
+
+	changed, err := source.Fetch(context.Background(), time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || source.blocking() {
+		t.Errorf("expected the index to be reset, changed: %v, blocking: %v", changed, source.blocking())
+	}
+
+	if _, err = source.Fetch(context.Background(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if !source.blocking() {
+		t.Error("expected the next query to block on the new index")
+	}
+}
+
+func TestConsulSourceWatchWithoutIndex(t *testing.T) {
+	handler := newConsulTestServer(map[string]string{"app/port": "8080"})
+	handler.omitIndex = true
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewConsulSource(ConsulSourceOptions{Address: server.URL, Prefix: "app", WaitTime: time.Minute})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	var changesMutex sync.Mutex
+	var changes []error
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		handler.set(map[string]string{"app/port": "9090"})
+	}()
+
+	err = source.Watch(ctx, func(err error) {
+		changesMutex.Lock()
+		defer changesMutex.Unlock()
+
+		changes = append(changes, err)
+	})
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected Watch to return context.DeadlineExceeded, got %v", err)
+	}
+
+	changesMutex.Lock()
+	defer changesMutex.Unlock()
+
+	// the queries don't block, so they're made once a second
+	if queries := handler.queryCount(); queries > 4 || len(changes) != 1 || changes[0] != nil {
+		t.Errorf("expected the change to be reported once without hammering the server, got %d queries and changes %v", queries, changes)
+	}
+
+	if port := MustGet[int](source, "port"); port != 9090 {
+		t.Errorf("expected 9090, got %d", port)
+	}
+}
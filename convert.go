@@ -0,0 +1,282 @@
+package confusing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Convert re-keys the document for another source type, using the given convention or the default one of the type
+// Env documents are nested according to schema, when it's not nil, otherwise every variable becomes a top-level key
+// When converting to env, nested objects are flattened into separate variables, while maps of the schema and arrays of
+// maps or arrays are encoded as JSON, with the keys of the JSON convention, which is how EnvSource reads them
+// The keys of maps of the schema are kept as they are, since they aren't named after fields
+func (d *Document) Convert(sourceType SourceType, convention string, schema *Schema) (*Document, error) {
+	tree := d.Data
+
+	if d.Type == EnvSourceType {
+		var err error
+
+		tree, err = d.envData(schema)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	canonical := rekey(tree, schema, snakeToCamel).(map[string]interface{})
+	converted := &Document{Type: sourceType, File: d.File}
+
+	normalizer, err := NormalizerForSourceType(convention, sourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sourceType != EnvSourceType {
+		converted.Data = rekey(canonical, schema, normalizer.Normalize).(map[string]interface{})
+
+		return converted, nil
+	}
+
+	jsonNormalizer, err := NormalizerForSourceType("", JSONSourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	converted.Data = make(map[string]interface{})
+
+	if err = flattenEnv(canonical, schema, "", normalizer, jsonNormalizer, converted.Data); err != nil {
+		return nil, err
+	}
+
+	return converted, nil
+}
+
+// envData nests the variables of an env document according to schema, keeping the unknown variables as top-level keys
+func (d *Document) envData(schema *Schema) (map[string]interface{}, error) {
+	if schema == nil {
+		return d.Data, nil
+	}
+
+	normalizer, err := NormalizerForSourceType("", EnvSourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(d.Data))
+
+	for name, value := range d.Data {
+		vars[name] = fmt.Sprint(value)
+	}
+
+	consumed := make(map[string]struct{})
+	tree, _ := schema.envTree(vars, d.Positions, normalizer, consumed)
+
+	for name, value := range vars {
+		if _, ok := consumed[name]; !ok {
+			tree[name] = value
+		}
+	}
+
+	return tree, nil
+}
+
+// Encode serializes the document in the format of its type
+func (d *Document) Encode() ([]byte, error) {
+	switch d.Type {
+	case YAMLSourceType:
+		var buf bytes.Buffer
+
+		e := yaml.NewEncoder(&buf)
+		e.SetIndent(2)
+
+		if err := e.Encode(d.Data); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case JSONSourceType:
+		data, err := json.MarshalIndent(d.Data, "", "  ")
+
+		if err != nil {
+			return nil, err
+		}
+
+		return append(data, '\n'), nil
+	case TOMLSourceType:
+		var buf bytes.Buffer
+
+		if err := toml.NewEncoder(&buf).Encode(tomlValue(d.Data)); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case EnvSourceType:
+		vars := make(map[string]string, len(d.Data))
+
+		for name, value := range d.Data {
+			vars[name] = fmt.Sprint(value)
+		}
+
+		data, err := godotenv.Marshal(vars)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(data + "\n"), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", UnsupportedDocumentError, d.Type)
+}
+
+// rekey applies fn to every key of the maps nested in value, except to the keys of the maps of schema when it's not nil
+func rekey(value interface{}, schema *Schema, fn func(key string) string) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+
+		for k, v := range val {
+			childSchema := schema.property(k)
+
+			if schema.isMap() {
+				m[k] = rekey(v, childSchema, fn)
+			} else {
+				m[fn(k)] = rekey(v, childSchema, fn)
+			}
+		}
+
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+
+		for k, v := range val {
+			m[fn(fmt.Sprint(k))] = rekey(v, nil, fn)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(val))
+
+		for i, v := range val {
+			items[i] = rekey(v, schema.items(), fn)
+		}
+
+		return items
+	}
+
+	return value
+}
+
+func flattenEnv(value interface{}, schema *Schema, key string, normalizer KeyNormalizer, jsonNormalizer KeyNormalizer, vars map[string]interface{}) error {
+	switch val := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		// EnvSource reads maps from a single variable
+		if schema.isMap() {
+			data, err := json.Marshal(rekey(val, schema, jsonNormalizer.Normalize))
+
+			if err != nil {
+				return err
+			}
+
+			vars[normalizer.Normalize(key)] = string(data)
+
+			return nil
+		}
+
+		for k, v := range val {
+			if err := flattenEnv(v, schema.property(k), concatenateKeys(key, k), normalizer, jsonNormalizer, vars); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case []interface{}:
+		items := make([]string, len(val))
+
+		for i, item := range val {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				data, err := json.Marshal(rekey(val, schema, jsonNormalizer.Normalize))
+
+				if err != nil {
+					return err
+				}
+
+				vars[normalizer.Normalize(key)] = string(data)
+
+				return nil
+			}
+
+			items[i] = formatEnvValue(item)
+		}
+
+		vars[normalizer.Normalize(key)] = strings.Join(items, ",")
+
+		return nil
+	}
+
+	vars[normalizer.Normalize(key)] = formatEnvValue(value)
+
+	return nil
+}
+
+// formatEnvValue formats a primitive so that EnvSource can read it back
+func formatEnvValue(value interface{}) string {
+	switch val := value.(type) {
+	case bool:
+		if val {
+			return "1"
+		}
+
+		return "0"
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// tomlValue removes the nulls of a value, since TOML has no null value, and converts integral floats to integers,
+// since JSON documents hold every number as a float, which would be written as 5432.0
+func tomlValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+
+		for k, v := range val {
+			if v != nil {
+				m[k] = tomlValue(v)
+			}
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, 0, len(val))
+
+		for _, v := range val {
+			if v != nil {
+				items = append(items, tomlValue(v))
+			}
+		}
+
+		return items
+	case float64:
+		if val == math.Trunc(val) && val >= math.MinInt64 && val < math.MaxInt64 {
+			return int64(val)
+		}
+	}
+
+	return value
+}
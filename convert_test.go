@@ -0,0 +1,116 @@
+package confusing
+
+import (
+	"github.com/joho/godotenv"
+	"reflect"
+	"testing"
+)
+
+type convertTestConfig struct {
+	WelcomeMessage string
+	HTTPPort       int
+	Debug          bool
+	Ratio          float64
+	Database       struct {
+		Host string
+		Port int
+	}
+	Replicas []struct {
+		Host string
+		Port int
+	}
+	Tags   []string
+	Labels map[string]string
+	Limits map[string]int
+}
+
+const convertTestYAML = `welcome_message: Hello world
+http_port: 8080
+debug: true
+ratio: 0.5
+database:
+  host: db1
+  port: 5432
+replicas:
+  - host: db2
+    port: 5433
+tags: [a, b]
+labels:
+  team: core
+  on_call: jackie
+limits:
+  public_api: 100
+`
+
+func TestConvertToEnv(t *testing.T) {
+	doc, err := DecodeDocument("config.yaml", YAMLSourceType, []byte(convertTestYAML))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewYAMLSource(doc.Data, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected convertTestConfig
+
+	if err = source.Read(&expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected.Labels["on_call"] != "jackie" || expected.Limits["public_api"] != 100 || len(expected.Replicas) != 1 {
+		t.Fatalf("the YAML document wasn't read, got %+v", expected)
+	}
+
+	schema, err := GenerateJSONSchema(expected, "", YAMLSourceType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := doc.Convert(EnvSourceType, "", schema)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := converted.Encode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := godotenv.UnmarshalBytes(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// maps are read from a single variable, keeping their keys as they are
+	if labels := vars["LABELS"]; labels != `{"on_call":"jackie","team":"core"}` {
+		t.Errorf("expected the labels to be a single JSON variable, got %q", labels)
+	}
+
+	for name, value := range vars {
+		t.Setenv(name, value)
+	}
+
+	envSource, err := NewEnvSource("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config convertTestConfig
+
+	if err = envSource.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+}
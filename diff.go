@@ -0,0 +1,181 @@
+package confusing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	KeyAdded   ChangeKind = "added"
+	KeyRemoved ChangeKind = "removed"
+	KeyChanged ChangeKind = "changed"
+)
+
+const maskedValue = "********"
+
+// secretWords are the words which make a key secret when its last segment contains them
+var secretWords = []string{"password", "passwd", "secret", "token", "apikey", "privatekey", "credential"}
+
+// Change is a difference between two documents, at a dotted key in camelCase
+type Change struct {
+	Key  string
+	Kind ChangeKind
+	Old  interface{}
+	New  interface{}
+	// Secret changes are displayed without their values
+	Secret bool
+}
+
+func (c Change) String() string {
+	format := func(value interface{}) string {
+		if c.Secret {
+			return maskedValue
+		}
+
+		return fmt.Sprintf("%v", value)
+	}
+
+	switch c.Kind {
+	case KeyAdded:
+		return fmt.Sprintf("+ %s: %s", c.Key, format(c.New))
+	case KeyRemoved:
+		return fmt.Sprintf("- %s: %s", c.Key, format(c.Old))
+	}
+
+	return fmt.Sprintf("~ %s: %s -> %s", c.Key, format(c.Old), format(c.New))
+}
+
+// IsSecretKey reports whether the last segment of the key looks like it holds a secret (e.g. password or apiKey)
+func IsSecretKey(key string) bool {
+	parts := strings.Split(key, ".")
+	name := strings.ToLower(snakeToCamel(parts[len(parts)-1]))
+
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Diff compares two documents, which may be of different types, by re-keying both of them to camelCase
+// Arrays are compared item by item, and values of different types are compared by their string representation
+// The schema, which may be nil, is used to nest env documents and to find the properties tagged as secret
+func Diff(a *Document, b *Document, schema *Schema) ([]Change, error) {
+	aLeaves, err := a.canonicalLeaves(schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bLeaves, err := b.canonicalLeaves(schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secretKeys := make(map[string]struct{})
+
+	if schema != nil {
+		schema.collectSecretKeys(secretKeys)
+	}
+
+	isSecret := func(key string) bool {
+		if _, ok := secretKeys[key]; ok {
+			return true
+		}
+
+		return IsSecretKey(key)
+	}
+
+	var changes []Change
+
+	for key, oldValue := range aLeaves {
+		newValue, ok := bLeaves[key]
+
+		if !ok {
+			changes = append(changes, Change{Key: key, Kind: KeyRemoved, Old: oldValue, Secret: isSecret(key)})
+		} else if !valuesEqual(oldValue, newValue) {
+			changes = append(changes, Change{Key: key, Kind: KeyChanged, Old: oldValue, New: newValue, Secret: isSecret(key)})
+		}
+	}
+
+	for key, newValue := range bLeaves {
+		if _, ok := aLeaves[key]; !ok {
+			changes = append(changes, Change{Key: key, Kind: KeyAdded, New: newValue, Secret: isSecret(key)})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes, nil
+}
+
+// canonicalLeaves flattens the document into a map of dotted camelCase keys to primitives
+func (d *Document) canonicalLeaves(schema *Schema) (map[string]interface{}, error) {
+	tree := d.Data
+
+	if d.Type == EnvSourceType {
+		var err error
+
+		tree, err = d.envData(schema)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	leaves := make(map[string]interface{})
+
+	flattenTree(rekey(tree, nil, snakeToCamel), "", leaves)
+
+	return leaves, nil
+}
+
+func flattenTree(value interface{}, key string, leaves map[string]interface{}) {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 && key != "" {
+			leaves[key] = val
+		}
+
+		for k, v := range val {
+			flattenTree(v, concatenateKeys(key, k), leaves)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			leaves[key] = val
+		}
+
+		for i, v := range val {
+			flattenTree(v, concatenateKeys(key, strconv.Itoa(i)), leaves)
+		}
+	default:
+		leaves[key] = value
+	}
+}
+
+// collectSecretKeys adds the camelCase keys of the properties tagged as secret
+// Properties of items of arrays and values of maps are skipped, since their keys depend on the data
+func (s *Schema) collectSecretKeys(keys map[string]struct{}) {
+	for _, property := range s.Properties {
+		if property.Secret && property.Key != "" {
+			parts := strings.Split(property.Key, ".")
+
+			for i, part := range parts {
+				parts[i] = snakeToCamel(part)
+			}
+
+			keys[strings.Join(parts, ".")] = struct{}{}
+		}
+
+		property.collectSecretKeys(keys)
+	}
+}
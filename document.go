@@ -0,0 +1,579 @@
+package confusing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var UnsupportedDocumentError = errors.New("unsupported document type")
+
+// Document is a config file decoded into a generic tree, without reading it into a struct
+// Env files are decoded into a flat map of variable names, since their nesting depends on the target
+type Document struct {
+	Type      SourceType
+	File      string
+	Data      map[string]interface{}
+	Positions map[string]Position
+}
+
+// Position returns the position of key in the file, or of its closest ancestor when the key itself is missing
+func (d *Document) Position(key string) Position {
+	for {
+		if position, ok := d.Positions[key]; ok {
+			return position
+		}
+
+		i := strings.LastIndex(key, ".")
+
+		if i < 0 {
+			return Position{File: d.File}
+		}
+
+		key = key[:i]
+	}
+}
+
+// ReadDocument decodes a YAML, JSON, TOML or env file
+// The source type is inferred from the file path when it's empty
+func ReadDocument(filePath string, sourceType SourceType) (*Document, error) {
+	if sourceType == "" {
+		sourceType = SourceTypeForFile(filePath)
+	}
+
+	data, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeDocument(filePath, sourceType, data)
+}
+
+// DecodeDocument is like ReadDocument, but decodes data which was already read from filePath
+func DecodeDocument(filePath string, sourceType SourceType, data []byte) (*Document, error) {
+	doc := &Document{
+		Type: sourceType,
+		File: filePath,
+		Data: map[string]interface{}{},
+	}
+
+	switch sourceType {
+	case YAMLSourceType:
+		var node yaml.Node
+
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+
+		if len(node.Content) > 0 {
+			if err := node.Decode(&doc.Data); err != nil {
+				return nil, err
+			}
+		}
+
+		doc.Positions = yamlPositions(filePath, &node)
+	case JSONSourceType:
+		var err error
+
+		if err = json.Unmarshal(data, &doc.Data); err != nil {
+			return nil, jsonDecodeError(filePath, data, err)
+		}
+
+		doc.Positions, err = jsonPositions(filePath, data)
+
+		if err != nil {
+			return nil, err
+		}
+	case TOMLSourceType:
+		if _, err := toml.Decode(string(data), &doc.Data); err != nil {
+			return nil, err
+		}
+
+		doc.Data = normalizeTOMLValue(doc.Data).(map[string]interface{})
+	case EnvSourceType:
+		vars, err := godotenv.UnmarshalBytes(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range vars {
+			doc.Data[name] = value
+		}
+
+		doc.Positions = envPositions(filePath, data)
+	default:
+		return nil, fmt.Errorf("%w: %s", UnsupportedDocumentError, sourceType)
+	}
+
+	return doc, nil
+}
+
+// envPositions maps the name of every variable in an env file to the position of its declaration
+func envPositions(file string, data []byte) map[string]Position {
+	positions := make(map[string]Position)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		trimmed := strings.TrimLeft(text, " \t")
+		column := len(text) - len(trimmed) + 1
+
+		if strings.HasPrefix(trimmed, "export ") {
+			column += len("export ")
+			trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, "export "), " \t")
+		}
+
+		name, _, ok := strings.Cut(trimmed, "=")
+
+		if !ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		name = strings.TrimSpace(name)
+
+		if _, ok := positions[name]; !ok {
+			positions[name] = Position{File: file, Line: line, Column: column}
+		}
+	}
+
+	return positions
+}
+
+type ValidationError struct {
+	Key      string
+	Message  string
+	Position Position
+}
+
+func (v ValidationError) Error() string {
+	if v.Position.File == "" {
+		return fmt.Sprintf("%s: %s", v.Key, v.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", v.Position, v.Key, v.Message)
+}
+
+// Validate checks the document against a schema generated by GenerateJSONSchema
+// Type errors, missing required keys and unknown keys are reported along with their position
+// For env files, variables are looked up by normalizing the keys of the schema with the env convention,
+// in which case every variable that doesn't belong to the schema is reported as unknown
+// Other files are checked against keys normalized with the default convention of their type, unless the schema was
+// generated for that type
+func (d *Document) Validate(schema *Schema) ([]ValidationError, error) {
+	var errs []ValidationError
+
+	data := d.Data
+	positions := d.Positions
+
+	if d.Type != EnvSourceType && schema.SourceType != d.Type {
+		normalizer, err := NormalizerForSourceType("", d.Type)
+
+		if err != nil {
+			return nil, err
+		}
+
+		schema = schema.renormalize(normalizer, "")
+	}
+
+	if d.Type == EnvSourceType {
+		normalizer, err := NormalizerForSourceType("", EnvSourceType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		vars := make(map[string]string, len(d.Data))
+
+		for name, value := range d.Data {
+			vars[name] = fmt.Sprint(value)
+		}
+
+		consumed := make(map[string]struct{})
+		data, positions = schema.envTree(vars, d.Positions, normalizer, consumed)
+
+		for name := range vars {
+			if _, ok := consumed[name]; !ok {
+				errs = append(errs, ValidationError{Key: name, Message: "unknown variable", Position: d.Positions[name]})
+			}
+		}
+	}
+
+	doc := &Document{Type: d.Type, File: d.File, Data: data, Positions: positions}
+	v := &validator{doc: doc, shallowJSON: d.Type == EnvSourceType}
+
+	v.validate(schema, data, "")
+	errs = append(v.errs, errs...)
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		a := errs[i].Position
+		b := errs[j].Position
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+
+		return errs[i].Key < errs[j].Key
+	})
+
+	return errs, nil
+}
+
+type validator struct {
+	doc  *Document
+	errs []ValidationError
+	// values of env variables holding JSON are read with another convention, so their properties aren't checked
+	shallowJSON bool
+}
+
+func (v *validator) report(key string, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+		Position: v.doc.Position(key),
+	})
+}
+
+func (v *validator) validate(schema *Schema, value interface{}, key string) {
+	// null values are skipped by the sources, just like missing ones
+	if value == nil {
+		return
+	}
+
+	if schema.boolean != nil {
+		if !*schema.boolean {
+			v.report(key, "unknown key")
+		}
+
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			v.report(key, "expected string, got %s", describeValue(value))
+
+			return
+		}
+	case "integer":
+		number, ok := toFloat(value)
+
+		if !ok || number != float64(int64(number)) {
+			v.report(key, "expected integer, got %s", describeValue(value))
+
+			return
+		}
+	case "number":
+		if _, ok := toFloat(value); !ok {
+			v.report(key, "expected number, got %s", describeValue(value))
+
+			return
+		}
+	case "boolean":
+		// MapSource also reads floats and strings as booleans
+		switch val := value.(type) {
+		case bool, float64:
+		case string:
+			if _, err := parseBool(val); err != nil {
+				v.report(key, "expected boolean, got %s", describeValue(value))
+
+				return
+			}
+		default:
+			v.report(key, "expected boolean, got %s", describeValue(value))
+
+			return
+		}
+	case "array":
+		items, ok := value.([]interface{})
+
+		if !ok {
+			v.report(key, "expected array, got %s", describeValue(value))
+
+			return
+		}
+
+		v.validateLength(key, len(items), schema.MinItems, schema.MaxItems, "items")
+
+		if schema.Items != nil {
+			for i, item := range items {
+				v.validateChild(schema.Items, item, concatenateKeys(key, fmt.Sprint(i)))
+			}
+		}
+	case "object":
+		m, ok := value.(map[string]interface{})
+
+		if !ok {
+			v.report(key, "expected object, got %s", describeValue(value))
+
+			return
+		}
+
+		v.validateObject(schema, m, key)
+	}
+
+	if s, ok := value.(string); ok {
+		v.validateLength(key, len(s), schema.MinLength, schema.MaxLength, "characters")
+	}
+
+	if number, ok := toFloat(value); ok {
+		if schema.Minimum != nil && number < *schema.Minimum {
+			v.report(key, "%v is less than the minimum of %v", value, *schema.Minimum)
+		}
+
+		if schema.Maximum != nil && number > *schema.Maximum {
+			v.report(key, "%v is greater than the maximum of %v", value, *schema.Maximum)
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if valuesEqual(value, allowed) {
+				return
+			}
+		}
+
+		v.report(key, "%v is not one of %v", value, schema.Enum)
+	}
+}
+
+func (v *validator) validateChild(schema *Schema, value interface{}, key string) {
+	if v.shallowJSON && schema.Type == "object" {
+		if _, ok := value.(map[string]interface{}); !ok {
+			v.report(key, "expected object, got %s", describeValue(value))
+		}
+
+		return
+	}
+
+	v.validate(schema, value, key)
+}
+
+func (v *validator) validateObject(schema *Schema, m map[string]interface{}, key string) {
+	for _, name := range schema.Required {
+		if _, ok := m[name]; !ok {
+			v.report(concatenateKeys(key, name), "missing required key")
+		}
+	}
+
+	var candidates []string
+
+	for name := range schema.Properties {
+		candidates = append(candidates, name)
+	}
+
+	for name, childValue := range m {
+		childKey := concatenateKeys(key, name)
+
+		if childSchema, ok := schema.Properties[name]; ok {
+			v.validate(childSchema, childValue, childKey)
+		} else if schema.AdditionalProperties != nil {
+			additional := schema.AdditionalProperties
+
+			if additional.boolean != nil && !*additional.boolean {
+				if suggestion := closestKey(name, candidates); suggestion != "" {
+					v.report(childKey, "unknown key (did you mean %s?)", suggestion)
+				} else {
+					v.report(childKey, "unknown key")
+				}
+
+				continue
+			}
+
+			v.validateChild(additional, childValue, childKey)
+		}
+	}
+}
+
+func (v *validator) validateLength(key string, length int, minimum *int, maximum *int, unit string) {
+	if minimum != nil && length < *minimum {
+		v.report(key, "expected at least %d %s, got %d", *minimum, unit, length)
+	}
+
+	if maximum != nil && length > *maximum {
+		v.report(key, "expected at most %d %s, got %d", *maximum, unit, length)
+	}
+}
+
+// envTree nests the variables matching the schema the way EnvSource would read them
+// The names of the consumed variables are added to consumed
+func (s *Schema) envTree(vars map[string]string, varPositions map[string]Position, normalizer KeyNormalizer, consumed map[string]struct{}) (map[string]interface{}, map[string]Position) {
+	tree := make(map[string]interface{})
+	positions := make(map[string]Position)
+
+	// envName is the name given by an env tag to the closest object holding the properties, and envKey is its key
+	var walk func(schema *Schema, tree map[string]interface{}, key string, envName string, envKey string)
+
+	walk = func(schema *Schema, tree map[string]interface{}, key string, envName string, envKey string) {
+		for name, property := range schema.Properties {
+			childKey := concatenateKeys(key, name)
+
+			if property.Env == "-" {
+				continue
+			}
+
+			childEnvName, childEnvKey := envName, envKey
+
+			if len(property.Env) > 0 {
+				childEnvName, childEnvKey = property.Env, property.Key
+			}
+
+			if property.Properties != nil {
+				child := make(map[string]interface{})
+				walk(property, child, childKey, childEnvName, childEnvKey)
+
+				if len(child) > 0 {
+					tree[name] = child
+				}
+
+				continue
+			}
+
+			if property.Key == "" {
+				continue
+			}
+
+			varName := normalizer.Normalize(property.Key)
+
+			// variables nested under a property with an env tag are named after it
+			if property.Key == childEnvKey {
+				varName = childEnvName
+			} else if len(childEnvName) > 0 {
+				varName = childEnvName + "_" + normalizer.Normalize(strings.TrimPrefix(property.Key, childEnvKey+"."))
+			}
+
+			value, ok := vars[varName]
+
+			if !ok {
+				continue
+			}
+
+			consumed[varName] = struct{}{}
+			tree[name] = parseEnvValue(property, value)
+			positions[childKey] = varPositions[varName]
+		}
+	}
+
+	walk(s, tree, "", "", "")
+
+	return tree, positions
+}
+
+// parseEnvValue converts the value of a variable the same way EnvSource does
+// Values that can't be converted are kept as strings, so that they are reported by the validator
+func parseEnvValue(schema *Schema, value string) interface{} {
+	switch schema.Type {
+	case "integer", "number", "boolean":
+		if schema.Type == "boolean" {
+			if valueBool, err := parseBool(value); err == nil {
+				return valueBool
+			}
+		} else if valueFloat, err := strconv.ParseFloat(value, 64); err == nil {
+			return valueFloat
+		}
+	case "array":
+		value = strings.TrimSpace(value)
+
+		if len(value) == 0 {
+			return []interface{}{}
+		}
+
+		if schema.Items != nil && (schema.Items.Type == "object" || schema.Items.Type == "array") {
+			var data []interface{}
+
+			if err := json.Unmarshal([]byte(value), &data); err == nil {
+				return data
+			}
+
+			return value
+		}
+
+		items := strings.Split(value, ",")
+		data := make([]interface{}, len(items))
+
+		for i, item := range items {
+			data[i] = strings.TrimSpace(item)
+
+			if schema.Items != nil {
+				data[i] = parseEnvValue(schema.Items, strings.TrimSpace(item))
+			}
+		}
+
+		return data
+	case "object":
+		var data map[string]interface{}
+
+		if err := json.Unmarshal([]byte(value), &data); err == nil {
+			return data
+		}
+	}
+
+	return value
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch val := value.(type) {
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case float64:
+		return val, true
+	}
+
+	return 0, false
+}
+
+func valuesEqual(a interface{}, b interface{}) bool {
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+
+	if !aIsString && !bIsString {
+		aFloat, aOk := toFloat(a)
+		bFloat, bOk := toFloat(b)
+
+		if aOk && bOk {
+			return aFloat == bFloat
+		}
+	}
+
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func describeValue(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", val)
+	case bool:
+		return "boolean"
+	case int, int64, uint64, float64:
+		return fmt.Sprintf("number %v", val)
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
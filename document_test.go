@@ -0,0 +1,85 @@
+package confusing
+
+import (
+	"reflect"
+	"testing"
+)
+
+type validateTestConfig struct {
+	WelcomeMessage string `required:"true"`
+	Database       struct {
+		HostName string `required:"true"`
+	}
+	URL      string `config:"db.url" yaml:"dsn"`
+	Replicas []struct {
+		MaxConnections int
+	}
+}
+
+func TestDocumentValidate(t *testing.T) {
+	schema, err := GenerateJSONSchema(validateTestConfig{}, "", YAMLSourceType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		sourceType SourceType
+		data       string
+		expected   []string
+	}{
+		{
+			name:       "yaml",
+			sourceType: YAMLSourceType,
+			data:       "welcome_message: hi\ndatabase:\n  host_name: db1\ndsn: postgres://db1\nreplicas:\n  - max_connections: 10\n",
+		},
+		{
+			name:       "json",
+			sourceType: JSONSourceType,
+			data:       `{"welcomeMessage": "hi", "database": {"hostName": "db1"}, "db": {"url": "postgres://db1"}, "replicas": [{"maxConnections": 10}]}`,
+		},
+		{
+			name:       "json with mistakes",
+			sourceType: JSONSourceType,
+			data:       `{"welcome_message": "hi", "database": {}, "replicas": [{"maxConnections": "10"}]}`,
+			expected: []string{
+				"config.json: welcomeMessage: missing required key",
+				"config.json:1:2: welcome_message: unknown key (did you mean welcomeMessage?)",
+				"config.json:1:27: database.hostName: missing required key",
+				"config.json:1:57: replicas.0.maxConnections: expected integer, got string \"10\"",
+			},
+		},
+		{
+			name:       "toml",
+			sourceType: TOMLSourceType,
+			data:       "welcome_message = \"hi\"\n[database]\nhost_name = \"db1\"\n[db]\nurl = \"postgres://db1\"\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := DecodeDocument("config."+test.sourceType, test.sourceType, []byte(test.data))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs, err := doc.Validate(schema)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var messages []string
+
+			for _, validationErr := range errs {
+				messages = append(messages, validationErr.Error())
+			}
+
+			if !reflect.DeepEqual(messages, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, messages)
+			}
+		})
+	}
+}
@@ -1,50 +1,194 @@
 package confusing
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const EnvSourceType SourceType = "env"
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
 type EnvSource struct {
+	// registry holding the aliases and the logger of the source, along with the plans of the structs it reads
+	registry   *Registry
 	normalizer KeyNormalizer
+	strict     bool
+	prefix     string
+}
+
+// consumingEnvSource reads an env source on behalf of a custom reader, recording the variables it looks up unless consumed
+// is nil
+// The keys given to it already include the prefix of the source, since they're prefixed with the key of the reader
+type consumingEnvSource struct {
+	*EnvSource
+	consumed map[string]struct{}
+}
+
+func (s *consumingEnvSource) ReadKey(key string, target interface{}) error {
+	return s.ReadKeyContext(context.Background(), key, target)
+}
+
+func (s *consumingEnvSource) ReadKeyContext(ctx context.Context, key string, target interface{}) error {
+	targetValue := reflect.ValueOf(target)
+
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return errors.New("target must be a non-nil pointer")
+	}
+
+	return s.readKey(ctx, key, targetValue, s.consumed)
+}
+
+func (s *consumingEnvSource) Has(key string) bool {
+	return s.has(key)
+}
+
+func (s *consumingEnvSource) Keys(prefix string) []string {
+	return s.keys(prefix)
 }
 
 type envQueueItem struct {
-	key    string
-	target reflect.Value
+	key string
+	// name of the variable given by an env tag, which isn't normalized
+	name string
+	// absolute keys the value is read from when the variable isn't set
+	aliases []string
+	target  reflect.Value
+}
+
+// variableName returns the name of the variable holding the value of an item
+func (s *EnvSource) variableName(item envQueueItem) string {
+	if len(item.name) > 0 {
+		return item.name
+	}
+
+	return s.normalizer.Normalize(item.key)
+}
+
+// readEnvVariable looks a variable up, recording its name in consumed unless it's nil
+func (s *EnvSource) readEnvVariable(name string, consumed map[string]struct{}) (string, bool) {
+	if consumed != nil {
+		consumed[name] = struct{}{}
+	}
+
+	return os.LookupEnv(name)
+}
+
+// readEnvItem reads the variable of an item, falling back to the variables of its aliases when it's not set
+func (s *EnvSource) readEnvItem(item envQueueItem, consumed map[string]struct{}) (string, bool, error) {
+	name := s.variableName(item)
+	value, ok := s.readEnvVariable(name, consumed)
+
+	for _, alias := range item.aliases {
+		aliasName := s.normalizer.Normalize(alias)
+		aliasValue, aliasOk := s.readEnvVariable(aliasName, consumed)
+
+		if !aliasOk {
+			continue
+		}
+
+		if !ok {
+			value, ok = aliasValue, true
+		} else if aliasValue != value {
+			return "", false, AliasConflictError{Key: name, Alias: aliasName}
+		}
+
+		s.registry.warnDeprecatedKey(aliasName, name)
+	}
+
+	return value, ok, nil
 }
 
-func (s *EnvSource) readEnvKey(key string) string {
-	key = s.normalizer.Normalize(key)
+// unknownVariables reports the environment variables under the configured prefix that weren't looked up
+func (s *EnvSource) unknownVariables(consumed map[string]struct{}) []UnknownKey {
+	var unknownKeys []UnknownKey
+	var candidates []string
 
-	return os.Getenv(key)
+	for name := range consumed {
+		candidates = append(candidates, name)
+	}
+
+	sort.Strings(candidates)
+
+	prefix := s.normalizer.Normalize(s.prefix) + "_"
+
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if _, ok := consumed[name]; ok {
+			continue
+		}
+
+		unknownKeys = append(unknownKeys, UnknownKey{
+			Key:        name,
+			Suggestion: closestKey(name, candidates),
+		})
+	}
+
+	sort.Slice(unknownKeys, func(i, j int) bool {
+		return unknownKeys[i].Key < unknownKeys[j].Key
+	})
+
+	return unknownKeys
 }
 
 // NOTE: Maps and slices of structs/slices don't make sense in environment variables
 // Maps are always parsed as JSON strings
 // By default, slices are parsed as comma-separated items
 // When a slice of structs/slices is encountered, the whole slice is parsed as a JSON string
-func (s *EnvSource) readEnvPrimitive(value string, targetValue reflect.Value) error {
+func (s *EnvSource) readEnvPrimitive(ctx context.Context, value string, targetValue reflect.Value) error {
 	targetType := targetValue.Elem().Type()
 
+	// durations are written like 30s, or as a number of nanoseconds
+	if targetType == durationType {
+		if duration, err := time.ParseDuration(value); err == nil {
+			targetValue.Elem().SetInt(int64(duration))
+
+			return nil
+		}
+	}
+
 	switch targetType.Kind() {
 	case reflect.String:
 		targetValue.Elem().SetString(value)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		valueInt, err := strconv.Atoi(value)
+		valueInt, err := strconv.ParseInt(value, 10, 64)
 
 		if err != nil {
 			return err
 		}
 
-		targetValue.Elem().SetInt(int64(valueInt))
+		// values which don't fit in the target are rejected, like map sources do
+		if targetValue.Elem().OverflowInt(valueInt) {
+			return strconv.ErrRange
+		}
+
+		targetValue.Elem().SetInt(valueInt)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		valueUint, err := strconv.ParseUint(value, 10, 64)
+
+		if err != nil {
+			return err
+		}
+
+		if targetValue.Elem().OverflowUint(valueUint) {
+			return strconv.ErrRange
+		}
+
+		targetValue.Elem().SetUint(valueUint)
 	case reflect.Float32, reflect.Float64:
 		valueFloat, err := strconv.ParseFloat(value, 64)
 
@@ -52,6 +196,10 @@ func (s *EnvSource) readEnvPrimitive(value string, targetValue reflect.Value) er
 			return err
 		}
 
+		if targetValue.Elem().OverflowFloat(valueFloat) {
+			return strconv.ErrRange
+		}
+
 		targetValue.Elem().SetFloat(valueFloat)
 	case reflect.Bool:
 		valueBool, err := parseBool(value)
@@ -62,7 +210,7 @@ func (s *EnvSource) readEnvPrimitive(value string, targetValue reflect.Value) er
 
 		targetValue.Elem().SetBool(valueBool)
 	case reflect.Map:
-		var data map[interface{}]interface{}
+		var data map[string]interface{}
 		var source *MapSource
 		err := json.Unmarshal([]byte(value), &data)
 
@@ -76,7 +224,7 @@ func (s *EnvSource) readEnvPrimitive(value string, targetValue reflect.Value) er
 			return err
 		}
 
-		return source.readMapPrimitive(reflect.ValueOf(data), targetValue)
+		return source.readMapPrimitive(ctx, reflect.ValueOf(data), targetValue)
 	default:
 		return errors.New("unsupported target type")
 	}
@@ -84,7 +232,7 @@ func (s *EnvSource) readEnvPrimitive(value string, targetValue reflect.Value) er
 	return nil
 }
 
-func (s *EnvSource) readEnvSlice(value string, targetPtr reflect.Value) error {
+func (s *EnvSource) readEnvSlice(ctx context.Context, value string, targetPtr reflect.Value) error {
 	sliceType := targetPtr.Elem().Type()
 
 	if len(value) > 0 {
@@ -106,27 +254,36 @@ func (s *EnvSource) readEnvSlice(value string, targetPtr reflect.Value) error {
 				return err
 			}
 
-			return source.readMapPrimitive(reflect.ValueOf(data), targetPtr)
+			return source.readMapPrimitive(ctx, reflect.ValueOf(data), targetPtr)
 		default:
 			valueSlice := strings.Split(value, ",")
 			valueSliceLen := len(valueSlice)
 
 			newSlice := reflect.MakeSlice(sliceType, valueSliceLen, valueSliceLen)
 
+			// items that can't be read are left empty, and the first of them is reported once the slice is set
+			var itemErr error
+
 			for i := range valueSlice {
 				valueSlice[i] = strings.TrimSpace(valueSlice[i])
 
 				elemType := sliceType.Elem()
 				elemPtr := reflect.New(elemType)
 
-				if err := s.readEnvPrimitive(valueSlice[i], elemPtr); err != nil {
+				if err := s.readEnvPrimitive(ctx, valueSlice[i], elemPtr); err != nil {
 					elemPtr.Elem().SetZero()
+
+					if itemErr == nil {
+						itemErr = fmt.Errorf("can't read item %d %q into %s", i, valueSlice[i], elemType)
+					}
 				}
 
 				newSlice.Index(i).Set(elemPtr.Elem())
 			}
 
 			targetPtr.Elem().Set(newSlice)
+
+			return itemErr
 		}
 	} else {
 		newSlice := reflect.MakeSlice(sliceType, 0, 0)
@@ -137,10 +294,16 @@ func (s *EnvSource) readEnvSlice(value string, targetPtr reflect.Value) error {
 	return nil
 }
 
-func (s *EnvSource) readKey(rootKey string, rootTargetValue reflect.Value) error {
-	queue := []envQueueItem{{rootKey, rootTargetValue}}
+// readKey reads the variables under rootKey, recording the names of the variables it looks up in consumed unless it's nil
+func (s *EnvSource) readKey(ctx context.Context, rootKey string, rootTargetValue reflect.Value, consumed map[string]struct{}) error {
+	queue := []envQueueItem{{key: rootKey, target: rootTargetValue}}
+	var errs []error
 
 	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		item := queue[0]
 		queue = queue[1:]
 
@@ -162,64 +325,105 @@ func (s *EnvSource) readKey(rootKey string, rootTargetValue reflect.Value) error
 
 		switch targetElemType.Kind() {
 		case reflect.Slice:
-			value := strings.TrimSpace(s.readEnvKey(item.key))
+			value, _, err := s.readEnvItem(item, consumed)
 
-			if err := s.readEnvSlice(value, targetPtr); err != nil {
+			if err != nil {
 				return err
 			}
+
+			if err = s.readEnvSlice(ctx, strings.TrimSpace(value), targetPtr); err != nil {
+				errs = append(errs, DecodeError{Key: s.variableName(item), Message: err.Error()})
+			}
 		case reflect.Struct:
-			reader, isReader := targetPtr.Interface().(Reader)
+			// the variables read by custom readers are consumed as well
+			source := &consumingEnvSource{EnvSource: s, consumed: consumed}
 
-			if isReader {
-				err := reader.ReadConfig(PrefixSourceWith(item.key, s))
+			isReader, err := readCustom(ctx, targetPtr, PrefixSourceWith(item.key, source))
 
-				if err != nil {
-					// errors from custom readers always break execution
-					// if you want your custom reader to remain fault-tolerant, do not return the errors you get from calling the configSource
-					return err
-				}
-			} else {
-				for i := 0; i < targetElemType.NumField(); i++ {
-					field := targetElemType.Field(i)
-					childKey := processStructField(field)
+			if err != nil {
+				// errors from custom readers always break execution
+				// if you want your custom reader to remain fault-tolerant, do not return the errors you get from calling the configSource
+				return err
+			}
+
+			if !isReader {
+				plan := s.registry.structPlanFor(targetElemType, EnvSourceType, s.normalizer)
+
+				for _, field := range plan.fields {
+					child := envQueueItem{key: concatenateKeys(item.key, field.key), target: targetPtr.Elem().Field(field.index).Addr()}
 
-					if childKey == "" {
-						continue
+					// fields nested under an aliased field are also read from the alias
+					for _, alias := range item.aliases {
+						child.aliases = append(child.aliases, concatenateKeys(alias, field.key))
 					}
 
-					var absoluteKey string
+					for _, alias := range field.aliases {
+						child.aliases = append(child.aliases, concatenateKeys(item.key, alias))
+					}
+
+					child.aliases = append(child.aliases, s.registry.registeredAliases(s.normalizer, s.normalizer.Normalize(child.key))...)
 
-					if len(item.key) > 0 {
-						absoluteKey = concatenateKeys(item.key, childKey)
-					} else {
-						absoluteKey = childKey
+					// variables of fields nested under a field with an env tag are named after it
+					if field.verbatim {
+						child.name = field.key
+					} else if len(item.name) > 0 {
+						child.name = item.name + "_" + field.normalizedKey
 					}
 
-					queue = append(queue, envQueueItem{absoluteKey, targetPtr.Elem().Field(i).Addr()})
+					queue = append(queue, child)
 				}
 			}
 		default:
-			if err := s.readEnvPrimitive(s.readEnvKey(item.key), targetPtr); err != nil {
-				// targetPtr.Elem().SetZero()
-				continue
+			value, ok, err := s.readEnvItem(item, consumed)
+
+			if err != nil {
+				return err
+			}
+
+			// values that can't be read are skipped, and reported once the rest of the target has been read
+			if err = s.readEnvPrimitive(ctx, value, targetPtr); err != nil && ok {
+				errs = append(errs, DecodeError{
+					Key:     s.variableName(item),
+					Message: fmt.Sprintf("can't read %q into %s", value, targetPtr.Elem().Type()),
+				})
 			}
 		}
 	}
 
-	return nil
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return errors.Join(errs...)
 }
 
+// ReadKey reads a key relative to the prefix of the source, like Read
 func (s *EnvSource) ReadKey(key string, target interface{}) error {
+	return s.ReadKeyContext(context.Background(), key, target)
+}
+
+func (s *EnvSource) ReadKeyContext(ctx context.Context, key string, target interface{}) error {
 	targetValue := reflect.ValueOf(target)
 
 	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
 		return errors.New("target must be a non-nil pointer")
 	}
 
-	return s.readKey(key, targetValue)
+	key = concatenateKeys(s.prefix, key)
+
+	// reading the struct stored under the prefix is checked like Read
+	if s.isStrictRead(key, targetValue) {
+		return s.readStrict(ctx, key, targetValue)
+	}
+
+	return s.readKey(ctx, key, targetValue, nil)
 }
 
 func (s *EnvSource) Read(target interface{}) error {
+	return s.ReadContext(context.Background(), target)
+}
+
+func (s *EnvSource) ReadContext(ctx context.Context, target interface{}) error {
 	targetValue := reflect.ValueOf(target)
 
 	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
@@ -232,7 +436,88 @@ func (s *EnvSource) Read(target interface{}) error {
 		return errors.New("target must be a struct")
 	}
 
-	return s.readKey("", targetValue)
+	if !s.isStrictRead(s.prefix, targetValue) {
+		return s.readKey(ctx, s.prefix, targetValue, nil)
+	}
+
+	return s.readStrict(ctx, s.prefix, targetValue)
+}
+
+// isStrictRead tells whether reading key into the target should report unknown variables
+// Without a prefix, every variable of the environment would be reported
+func (s *EnvSource) isStrictRead(key string, targetValue reflect.Value) bool {
+	if !s.strict || len(s.prefix) == 0 || targetValue.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	return s.normalizer.Normalize(key) == s.normalizer.Normalize(s.prefix)
+}
+
+// readStrict reads the struct stored under the prefix, reporting the variables under it which weren't looked up
+func (s *EnvSource) readStrict(ctx context.Context, key string, targetValue reflect.Value) error {
+	consumed := make(map[string]struct{})
+	err := s.readKey(ctx, key, targetValue, consumed)
+	var decodeErr DecodeError
+
+	// unknown variables are reported along with the values that couldn't be read, like map sources do
+	if err != nil && !errors.As(err, &decodeErr) {
+		return err
+	}
+
+	unknownKeys := s.unknownVariables(consumed)
+
+	if len(unknownKeys) == 0 {
+		return err
+	}
+
+	if err == nil {
+		return UnknownKeysError{Keys: unknownKeys}
+	}
+
+	return errors.Join(err, UnknownKeysError{Keys: unknownKeys})
+}
+
+// Has also reports nested keys as set, e.g. "database" is set when DATABASE_HOST is
+// Like ReadKey, the key is relative to the prefix of the source
+func (s *EnvSource) Has(key string) bool {
+	return s.has(concatenateKeys(s.prefix, key))
+}
+
+func (s *EnvSource) has(key string) bool {
+	name := s.normalizer.Normalize(key)
+
+	if _, ok := os.LookupEnv(name); ok {
+		return true
+	}
+
+	return len(s.keys(key)) > 0
+}
+
+// Keys lists the variables starting with the normalized prefix, without the prefix itself
+// Since variables are flat, nested keys are returned as a whole (e.g. HOST and OAUTH2_KEY)
+// Like ReadKey, the prefix is relative to the prefix of the source
+func (s *EnvSource) Keys(prefix string) []string {
+	return s.keys(concatenateKeys(s.prefix, prefix))
+}
+
+func (s *EnvSource) keys(prefix string) []string {
+	var keys []string
+
+	if len(prefix) > 0 {
+		prefix = s.normalizer.Normalize(prefix) + "_"
+	}
+
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+
+		if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+			keys = append(keys, strings.TrimPrefix(name, prefix))
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
 }
 
 func (s *EnvSource) Type() string {
@@ -240,13 +525,19 @@ func (s *EnvSource) Type() string {
 }
 
 func NewEnvSource(convention string) (*EnvSource, error) {
-	normalizer, err := NormalizerForSourceType(convention, EnvSourceType)
+	return newEnvSource(nil, convention)
+}
+
+// newEnvSource builds an env source, resolving its convention with the registry
+func newEnvSource(registry *Registry, convention string) (*EnvSource, error) {
+	registry = registryOrDefault(registry)
+	normalizer, err := registry.NormalizerForSourceType(convention, EnvSourceType)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &EnvSource{normalizer: normalizer}, nil
+	return &EnvSource{registry: registry, normalizer: normalizer}, nil
 }
 
 // BuildEnvSource This function only fails if the .env file path is explicitly provided and doesn't exist
@@ -270,5 +561,14 @@ func BuildEnvSource(opts SourceOptions) (Source, error) {
 		}
 	}
 
-	return NewEnvSource(opts.Convention)
+	source, err := newEnvSource(opts.Registry, opts.Convention)
+
+	if err != nil {
+		return nil, err
+	}
+
+	source.strict = opts.Strict
+	source.prefix = opts.EnvPrefix
+
+	return source, nil
 }
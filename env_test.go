@@ -0,0 +1,124 @@
+package confusing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvSourceReadPrimitive(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		target   interface{}
+		expected interface{}
+	}{
+		{name: "int", value: "-8080", target: new(int), expected: -8080},
+		{name: "uint16", value: "8080", target: new(uint16), expected: uint16(8080)},
+		{name: "uint64", value: "18446744073709551615", target: new(uint64), expected: uint64(18446744073709551615)},
+		{name: "negative uint", value: "-1", target: new(uint)},
+		{name: "overflowing uint8", value: "300", target: new(uint8)},
+		{name: "duration", value: "1m30s", target: new(time.Duration), expected: 90 * time.Second},
+		{name: "duration in nanoseconds", value: "1000", target: new(time.Duration), expected: time.Microsecond},
+		{name: "invalid duration", value: "soon", target: new(time.Duration)},
+		{name: "overflowing int8", value: "300", target: new(int8)},
+		{name: "overflowing int64", value: "9223372036854775808", target: new(int64)},
+		{name: "float32", value: "0.5", target: new(float32), expected: float32(0.5)},
+		{name: "overflowing float32", value: "1e39", target: new(float32)},
+		{name: "bool", value: "true", target: new(bool), expected: true},
+		{name: "invalid int", value: "abc", target: new(int)},
+	}
+
+	source, err := NewEnvSource("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("VALUE", test.value)
+
+			err := source.ReadKey("value", test.target)
+
+			if test.expected == nil {
+				var decodeErr DecodeError
+
+				if !errors.As(err, &decodeErr) || decodeErr.Key != "VALUE" {
+					t.Errorf("expected a DecodeError for VALUE, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value := reflect.ValueOf(test.target).Elem().Interface(); value != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, value)
+			}
+		})
+	}
+}
+
+// envTestPort reads itself through the keys of the source it's given
+type envTestPort struct {
+	Number int
+	Set    bool
+}
+
+func (p *envTestPort) ReadConfig(source Source) error {
+	p.Set = source.(KeyedSource).Has("number")
+
+	return source.ReadKey("number", &p.Number)
+}
+
+func TestEnvSourcePrefix(t *testing.T) {
+	t.Setenv("APP_DATABASE_HOST", "db1")
+	t.Setenv("APP_DATABASE_PORT_NUMBER", "5432")
+	t.Setenv("DATABASE_HOST", "unprefixed")
+
+	source, err := BuildEnvSource(SourceOptions{EnvPrefix: "app"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyed := source.(KeyedSource)
+
+	var host string
+
+	if err = source.ReadKey("database.host", &host); err != nil {
+		t.Fatal(err)
+	}
+
+	if host != "db1" {
+		t.Errorf("expected db1, got %s", host)
+	}
+
+	if !keyed.Has("database") || keyed.Has("host") {
+		t.Error("expected Has to look keys up under the prefix")
+	}
+
+	if keys := keyed.Keys("database"); !reflect.DeepEqual(keys, []string{"HOST", "PORT_NUMBER"}) {
+		t.Errorf("expected the keys under APP_DATABASE, got %v", keys)
+	}
+
+	// custom readers are given keys relative to their own key, which already holds the prefix
+	var config struct {
+		Database struct {
+			Host string
+			Port envTestPort
+		}
+	}
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Database.Host != "db1" || config.Database.Port != (envTestPort{Number: 5432, Set: true}) {
+		t.Errorf("got %+v", config)
+	}
+}
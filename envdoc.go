@@ -0,0 +1,198 @@
+package confusing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	CommaSeparatedSyntax = "comma-separated"
+	JSONSyntax           = "JSON"
+)
+
+// EnvVariable describes an environment variable read by EnvSource
+type EnvVariable struct {
+	Name        string
+	Key         string
+	Type        string
+	Default     string
+	Required    bool
+	Description string
+	// Syntax is CommaSeparatedSyntax or JSONSyntax for slices and maps, and empty otherwise
+	Syntax string
+}
+
+// GenerateEnvReference lists the environment variables EnvSource reads into target, a struct or a pointer to one
+// Keys are prefixed with prefix, which may be empty, and normalized with the given convention or the env one
+// Structs implementing Reader are skipped, since the keys they read aren't known in advance
+func GenerateEnvReference(target interface{}, prefix string, convention string) ([]EnvVariable, error) {
+	normalizer, err := NormalizerForSourceType(convention, EnvSourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(target)
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("target must be a struct")
+	}
+
+	var vars []EnvVariable
+
+	collectEnvVariables(t, prefix, "", normalizer, &vars)
+
+	return vars, nil
+}
+
+// name is the name given by an env tag to the struct being collected, which prefixes the names of its fields
+func collectEnvVariables(t reflect.Type, key string, name string, normalizer KeyNormalizer, vars *[]EnvVariable) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		childKey, verbatim := processSourceField(field, EnvSourceType)
+
+		if childKey == "" {
+			continue
+		}
+
+		absoluteKey := concatenateKeys(key, stringOrDefault(processStructField(field), childKey))
+		childName := ""
+
+		if verbatim {
+			childName = childKey
+		} else if len(name) > 0 {
+			childName = name + "_" + normalizer.Normalize(childKey)
+		}
+
+		fieldType := field.Type
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if fieldType.Kind() == reflect.Struct {
+			if !isCustomReader(fieldType) {
+				collectEnvVariables(fieldType, absoluteKey, childName, normalizer, vars)
+			}
+
+			continue
+		}
+
+		variable := EnvVariable{
+			Name:        stringOrDefault(childName, normalizer.Normalize(absoluteKey)),
+			Key:         absoluteKey,
+			Type:        field.Type.String(),
+			Default:     field.Tag.Get("default"),
+			Required:    isRequiredField(field),
+			Description: field.Tag.Get("description"),
+		}
+
+		switch fieldType.Kind() {
+		case reflect.Map:
+			variable.Syntax = JSONSyntax
+		case reflect.Slice:
+			// same rules as EnvSource.readEnvSlice
+			switch fieldType.Elem().Kind() {
+			case reflect.Struct, reflect.Slice:
+				variable.Syntax = JSONSyntax
+			default:
+				variable.Syntax = CommaSeparatedSyntax
+			}
+		}
+
+		*vars = append(*vars, variable)
+	}
+}
+
+// FormatEnvExample writes the variables as a .env.example file, documenting each variable in comments
+func FormatEnvExample(vars []EnvVariable) []byte {
+	var buf bytes.Buffer
+
+	for i, variable := range vars {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		if variable.Description != "" {
+			fmt.Fprintf(&buf, "# %s\n", variable.Description)
+		}
+
+		details := []string{variable.Type}
+
+		if variable.Syntax == CommaSeparatedSyntax {
+			details[0] += " (comma-separated)"
+		} else if variable.Syntax == JSONSyntax {
+			details[0] += " (JSON)"
+		}
+
+		if variable.Required {
+			details = append(details, "required")
+		}
+
+		fmt.Fprintf(&buf, "# %s\n", strings.Join(details, ", "))
+		fmt.Fprintf(&buf, "%s=%s\n", variable.Name, quoteEnvValue(variable.Default))
+	}
+
+	return buf.Bytes()
+}
+
+// FormatEnvMarkdown writes the variables as a Markdown table
+func FormatEnvMarkdown(vars []EnvVariable) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("| Variable | Type | Default | Required | Syntax | Description |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+
+	for _, variable := range vars {
+		required := "no"
+
+		if variable.Required {
+			required = "yes"
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"| `%s` | `%s` | %s | %s | %s | %s |\n",
+			variable.Name,
+			variable.Type,
+			markdownCode(variable.Default),
+			required,
+			variable.Syntax,
+			escapeMarkdownCell(variable.Description),
+		)
+	}
+
+	return buf.Bytes()
+}
+
+func quoteEnvValue(value string) string {
+	if value == "" || !strings.ContainsAny(value, " \t#'\"\\$") {
+		return value
+	}
+
+	// single-quoted values are read literally, which suits JSON
+	if !strings.Contains(value, "'") {
+		return fmt.Sprintf("'%s'", value)
+	}
+
+	return fmt.Sprintf("%q", value)
+}
+
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("`%s`", escapeMarkdownCell(value))
+}
+
+func escapeMarkdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
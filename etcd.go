@@ -0,0 +1,391 @@
+package confusing
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const EtcdSourceType SourceType = "etcd"
+
+type EtcdSourceOptions struct {
+	// Endpoint of the gRPC gateway of etcd, defaulting to http://127.0.0.1:2379
+	Endpoint string
+	// Prefix of the keys to read, to which a slash is appended if it doesn't end with one
+	Prefix     string
+	Convention string
+	Strict     bool
+	FuzzyKeys  bool
+	// Registry resolves the convention the keys of etcd are written in, or is the default registry when it's nil
+	Registry *Registry
+	// Username and Password are used to request a token when Username is set
+	Username string
+	Password string
+	// RootCAs verifies the certificate of the gateway over HTTPS, like ETCDCTL_CACERT does for etcdctl
+	RootCAs *x509.CertPool
+	// Client replaces the default client trusting RootCAs, and mustn't time out since watch streams stay open
+	Client *http.Client
+}
+
+type EtcdError struct {
+	Code    int
+	Message string
+}
+
+func (e EtcdError) Error() string {
+	return fmt.Sprintf("etcd: %s (code %d)", e.Message, e.Code)
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// etcdKV is a key of etcd, whose key and value are both base64-encoded by the JSON API
+type etcdKV struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// EtcdSource reads the keys stored under a prefix through the JSON API of etcd v3, nesting them by splitting their paths on slashes
+// Values are decoded as YAML (and therefore JSON) when possible, so that numbers, booleans and lists keep their types
+type EtcdSource struct {
+	remoteSource
+	opts   EtcdSourceOptions
+	client *http.Client
+	// held while fetching, since the token and revision are updated along with the data
+	fetching sync.Mutex
+	token    string
+	revision int64
+}
+
+func (s *EtcdSource) prefix() string {
+	if len(s.opts.Prefix) == 0 || strings.HasSuffix(s.opts.Prefix, "/") {
+		return s.opts.Prefix
+	}
+
+	return s.opts.Prefix + "/"
+}
+
+// keyRange returns the range of the keys starting with the prefix, as expected by etcd
+func (s *EtcdSource) keyRange() ([]byte, []byte) {
+	prefix := s.prefix()
+
+	// an empty prefix is written as \x00 to select every key
+	if len(prefix) == 0 {
+		return []byte{0}, []byte{0}
+	}
+
+	end := []byte(prefix)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return []byte(prefix), end[:i+1]
+		}
+	}
+
+	return []byte(prefix), []byte{0}
+}
+
+// post sends a request to the JSON API, and returns the response once it has been checked for errors
+func (s *EtcdSource) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v3/%s", strings.TrimRight(s.opts.Endpoint, "/"), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(s.token) > 0 {
+		req.Header.Set("Authorization", s.token)
+	}
+
+	res, err := s.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+
+		etcdErr := EtcdError{Code: res.StatusCode, Message: res.Status}
+		_ = json.NewDecoder(res.Body).Decode(&etcdErr)
+
+		return nil, etcdErr
+	}
+
+	return res, nil
+}
+
+func (s *EtcdSource) authenticate(ctx context.Context) error {
+	res, err := s.post(ctx, "auth/authenticate", map[string]string{"name": s.opts.Username, "password": s.opts.Password})
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&auth); err != nil {
+		return err
+	}
+
+	s.token = auth.Token
+
+	return nil
+}
+
+// Fetch reads the keys under the prefix, and reports whether they changed since the last fetch
+func (s *EtcdSource) Fetch(ctx context.Context) (bool, error) {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	if len(s.opts.Username) > 0 && len(s.token) == 0 {
+		if err := s.authenticate(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	key, end := s.keyRange()
+	body := map[string][]byte{"key": key, "range_end": end}
+	res, err := s.post(ctx, "kv/range", body)
+
+	var etcdErr EtcdError
+
+	// tokens expire after a few minutes without being used
+	if errors.As(err, &etcdErr) && len(s.opts.Username) > 0 && strings.Contains(etcdErr.Message, "token") {
+		if err = s.authenticate(ctx); err != nil {
+			return false, err
+		}
+
+		res, err = s.post(ctx, "kv/range", body)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer res.Body.Close()
+
+	var kvs struct {
+		Header etcdHeader `json:"header"`
+		KVs    []etcdKV   `json:"kvs"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&kvs); err != nil {
+		return false, err
+	}
+
+	if kvs.Header.Revision == s.revision {
+		return false, nil
+	}
+
+	pairs := make([]kvPair, len(kvs.KVs))
+
+	for i, kv := range kvs.KVs {
+		pairs[i] = kvPair{Key: string(kv.Key), Value: kv.Value}
+	}
+
+	source, err := newMapSource(s.registry, EtcdSourceType, kvTree(s.prefix(), pairs), s.opts.Convention)
+
+	if err != nil {
+		return false, err
+	}
+
+	source.strict = s.opts.Strict
+	source.fuzzy = s.opts.FuzzyKeys
+
+	s.swap(source)
+	s.revision = kvs.Header.Revision
+
+	return true, nil
+}
+
+// watch opens a watch stream starting after the last fetched revision, and fetches the keys whenever they change
+func (s *EtcdSource) watch(ctx context.Context, onChange func(err error)) error {
+	s.fetching.Lock()
+
+	key, end := s.keyRange()
+	res, err := s.post(ctx, "watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            key,
+			"range_end":      end,
+			"start_revision": fmt.Sprint(s.revision + 1),
+		},
+	})
+
+	s.fetching.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+
+	for {
+		var message struct {
+			Result struct {
+				Canceled     bool              `json:"canceled"`
+				CancelReason string            `json:"cancel_reason"`
+				Events       []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *EtcdError `json:"error"`
+		}
+
+		if err = decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if message.Error != nil {
+			return *message.Error
+		}
+
+		if message.Result.Canceled {
+			return fmt.Errorf("etcd: watch canceled: %s", message.Result.CancelReason)
+		}
+
+		// the keys are fetched again rather than patched, so that the tree is rebuilt the same way
+		if len(message.Result.Events) > 0 {
+			changed, err := s.Fetch(ctx)
+
+			if err != nil || changed {
+				onChange(err)
+			}
+		}
+	}
+}
+
+// Watch streams the changes made under the prefix, reconnecting when the stream is interrupted
+func (s *EtcdSource) Watch(ctx context.Context, onChange func(err error)) error {
+	for {
+		err := s.watch(ctx, onChange)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		onChange(err)
+
+		// streams interrupted by a failing server would otherwise be reopened in a loop, so reconnecting waits a second
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+
+		// changes made while reconnecting may have been compacted away, so the keys are fetched again
+		changed, err := s.Fetch(ctx)
+
+		if err != nil || changed {
+			onChange(err)
+		}
+	}
+}
+
+// NewEtcdSource is like NewEtcdSourceContext, without a deadline for the first fetch
+func NewEtcdSource(opts EtcdSourceOptions) (*EtcdSource, error) {
+	return NewEtcdSourceContext(context.Background(), opts)
+}
+
+// NewEtcdSourceContext reads the keys under the prefix once, failing if they can't be read
+func NewEtcdSourceContext(ctx context.Context, opts EtcdSourceOptions) (*EtcdSource, error) {
+	if len(opts.Endpoint) == 0 {
+		opts.Endpoint = "http://127.0.0.1:2379"
+	}
+
+	client := opts.Client
+
+	// no timeout, since watch streams stay open
+	if client == nil {
+		client = newRemoteClient(opts.RootCAs, 0)
+	}
+
+	source := &EtcdSource{
+		remoteSource: remoteSource{typ: EtcdSourceType, registry: registryOrDefault(opts.Registry)},
+		opts:         opts,
+		client:       client,
+	}
+
+	if _, err := source.Fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// BuildEtcdSource is like BuildEtcdSourceContext, without a deadline for the first fetch
+func BuildEtcdSource(opts SourceOptions) (Source, error) {
+	return BuildEtcdSourceContext(context.Background(), opts)
+}
+
+// BuildEtcdSourceContext reads the endpoint and the prefix from a file path such as etcd://127.0.0.1:2379/config/api,
+// where ?tls=1 switches to HTTPS, and the credentials from ETCDCTL_USER (as user:password) and ETCDCTL_CACERT
+func BuildEtcdSourceContext(ctx context.Context, opts SourceOptions) (Source, error) {
+	u, err := url.Parse(opts.FilePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != EtcdSourceType {
+		return nil, errors.New("the file path of an etcd source must be an etcd:// URL")
+	}
+
+	scheme := "http"
+
+	if parseBoolOrDefault(u.Query().Get("tls"), false) {
+		scheme = "https"
+	}
+
+	// the slash separating the host from the path isn't part of the prefix, so keys starting with a slash are read
+	// with a double slash (e.g. etcd://127.0.0.1:2379//config/api)
+	prefix := strings.TrimPrefix(u.Path, "/")
+
+	etcdOpts := EtcdSourceOptions{
+		Endpoint:   fmt.Sprintf("%s://%s", scheme, u.Host),
+		Prefix:     prefix,
+		Convention: opts.Convention,
+		Strict:     opts.Strict,
+		FuzzyKeys:  opts.FuzzyKeys,
+		Registry:   opts.Registry,
+	}
+
+	etcdOpts.Username, etcdOpts.Password, _ = strings.Cut(os.Getenv("ETCDCTL_USER"), ":")
+
+	if caFile := os.Getenv("ETCDCTL_CACERT"); len(caFile) > 0 {
+		if etcdOpts.RootCAs, err = loadRootCAs(caFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewEtcdSourceContext(ctx, etcdOpts)
+}
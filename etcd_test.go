@@ -0,0 +1,310 @@
+package confusing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// etcdTestServer serves the JSON gateway of etcd, expiring its auth token on demand
+type etcdTestServer struct {
+	mutex    sync.Mutex
+	kvs      map[string]string
+	revision int64
+	// closed when the store changes
+	changed  chan struct{}
+	username string
+	password string
+	token    string
+	logins   int
+}
+
+func newEtcdTestServer(kvs map[string]string) *etcdTestServer {
+	return &etcdTestServer{kvs: kvs, revision: 1, changed: make(chan struct{})}
+}
+
+func (s *etcdTestServer) set(key string, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.kvs[key] = value
+	s.revision++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *etcdTestServer) expireToken() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.token = ""
+}
+
+func (s *etcdTestServer) loginCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.logins
+}
+
+func (s *etcdTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name          string `json:"name"`
+		Password      string `json:"password"`
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		CreateRequest struct {
+			StartRevision int64 `json:"start_revision,string"`
+		} `json:"create_request"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	s.mutex.Lock()
+
+	if r.URL.Path == "/v3/auth/authenticate" {
+		defer s.mutex.Unlock()
+
+		if body.Name != s.username || body.Password != s.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code": 3, "message": "etcdserver: authentication failed, invalid user ID or password"}`))
+
+			return
+		}
+
+		s.logins++
+		s.token = "token" + strconv.Itoa(s.logins)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": s.token})
+
+		return
+	}
+
+	if len(s.username) > 0 && (len(s.token) == 0 || r.Header.Get("Authorization") != s.token) {
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code": 16, "message": "etcdserver: invalid auth token"}`))
+
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		defer s.mutex.Unlock()
+
+		var kvs []etcdKV
+
+		for key, value := range s.kvs {
+			if key >= string(body.Key) && key < string(body.RangeEnd) {
+				kvs = append(kvs, etcdKV{Key: []byte(key), Value: []byte(value)})
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"header": map[string]string{"revision": strconv.FormatInt(s.revision, 10)},
+			"kvs":    kvs,
+		})
+	case "/v3/watch":
+		changed := s.changed
+
+		// changes made since the start revision are streamed right away
+		if body.CreateRequest.StartRevision <= s.revision {
+			changed = make(chan struct{})
+			close(changed)
+		}
+
+		s.mutex.Unlock()
+
+		_, _ = w.Write([]byte(`{"result": {"created": true}}` + "\n"))
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changed:
+			}
+
+			s.mutex.Lock()
+			changed = s.changed
+			s.mutex.Unlock()
+
+			_, _ = w.Write([]byte(`{"result": {"events": [{"type": "PUT"}]}}` + "\n"))
+			w.(http.Flusher).Flush()
+		}
+	default:
+		s.mutex.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEtcdSourceFetch(t *testing.T) {
+	server := httptest.NewServer(newEtcdTestServer(map[string]string{
+		"app/database/host": "db1",
+		"app/database/port": "5432",
+		"app/tags":          `["a", "b"]`,
+		"app-v2/port":       "9090",
+	}))
+	defer server.Close()
+
+	source, err := NewEtcdSource(EtcdSourceOptions{Endpoint: server.URL, Prefix: "app"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Database struct {
+			Host string
+			Port int
+		}
+		Tags []string
+	}
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Database.Host != "db1" || config.Database.Port != 5432 || !reflect.DeepEqual(config.Tags, []string{"a", "b"}) {
+		t.Errorf("got %+v", config)
+	}
+
+	if keys := source.Keys(""); !reflect.DeepEqual(keys, []string{"database", "tags"}) {
+		t.Errorf("expected the keys of app only, got %v", keys)
+	}
+
+	// the revision didn't change
+	changed, err := source.Fetch(context.Background())
+
+	if err != nil || changed {
+		t.Errorf("expected the keys to be unchanged, changed: %v, error: %v", changed, err)
+	}
+}
+
+func TestEtcdSourceAuth(t *testing.T) {
+	handler := newEtcdTestServer(map[string]string{"app/port": "8080"})
+	handler.username, handler.password = "user", "pass"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if _, err := NewEtcdSource(EtcdSourceOptions{Endpoint: server.URL, Prefix: "app", Username: "user", Password: "wrong"}); err == nil {
+		t.Error("expected wrong credentials to be reported")
+	}
+
+	source, err := NewEtcdSource(EtcdSourceOptions{Endpoint: server.URL, Prefix: "app", Username: "user", Password: "pass"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the source logs in again once its token expires
+	handler.expireToken()
+	handler.set("app/port", "9090")
+
+	changed, err := source.Fetch(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var port int
+
+	if err = source.ReadKey("port", &port); err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || port != 9090 || handler.loginCount() != 2 {
+		t.Errorf("expected the keys to be read after logging in again, changed: %v, port: %d, logins: %d", changed, port, handler.loginCount())
+	}
+}
+
+func TestEtcdSourceWatch(t *testing.T) {
+	handler := newEtcdTestServer(map[string]string{"app/port": "8080"})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewEtcdSource(EtcdSourceOptions{Endpoint: server.URL, Prefix: "app"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := make(chan error, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- source.Watch(ctx, func(err error) {
+			changes <- err
+		})
+	}()
+
+	handler.set("app/port", "9090")
+
+	select {
+	case err = <-changes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the change wasn't reported")
+	}
+
+	var port int
+
+	if err = source.ReadKey("port", &port); err != nil {
+		t.Fatal(err)
+	}
+
+	if port != 9090 {
+		t.Errorf("expected 9090, got %d", port)
+	}
+
+	cancel()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to return context.Canceled, got %v", err)
+	}
+}
+
+func TestBuildEtcdSource(t *testing.T) {
+	server := httptest.NewServer(newEtcdTestServer(map[string]string{
+		"app/port":  "8080",
+		"/app/port": "9090",
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{path: "/app", expected: 8080},
+		{path: "//app", expected: 9090},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			source, err := BuildEtcdSource(SourceOptions{FilePath: "etcd://" + strings.TrimPrefix(server.URL, "http://") + test.path})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if port := MustGet[int](source, "port"); port != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, port)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package confusing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AmbiguousKeyError is returned in fuzzy mode when several keys of a map match the same key
+type AmbiguousKeyError struct {
+	Key        string
+	Candidates []string
+}
+
+func (a AmbiguousKeyError) Error() string {
+	return fmt.Sprintf("ambiguous key %s: matches %s", a.Key, strings.Join(a.Candidates, ", "))
+}
+
+// canonicalKey lowercases a part of a key and strips its separators, so that it's the same in every convention
+func canonicalKey(part string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(part))
+}
+
+// matchKey returns the key of m matching a normalized part of a key
+// In fuzzy mode, a part which isn't in m is looked up by its canonical form instead
+func (s *MapSource) matchKey(m map[string]interface{}, parentKey string, part string) (string, bool, error) {
+	if _, ok := m[part]; ok || !s.fuzzy {
+		return part, ok, nil
+	}
+
+	canonical := canonicalKey(part)
+
+	var matches []string
+
+	for key := range m {
+		if canonicalKey(key) == canonical {
+			matches = append(matches, key)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return part, false, nil
+	case 1:
+		return matches[0], true, nil
+	}
+
+	sort.Strings(matches)
+
+	for i, match := range matches {
+		matches[i] = concatenateKeys(parentKey, match)
+	}
+
+	return "", false, AmbiguousKeyError{Key: concatenateKeys(parentKey, part), Candidates: matches}
+}
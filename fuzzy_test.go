@@ -0,0 +1,68 @@
+package confusing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      map[string]interface{}
+		expected  string
+		ambiguous []string
+	}{
+		{
+			name:     "exact key",
+			data:     map[string]interface{}{"welcome_message": "exact", "welcomeMessage": "camel"},
+			expected: "exact",
+		},
+		{
+			name:     "other convention",
+			data:     map[string]interface{}{"welcomeMessage": "camel"},
+			expected: "camel",
+		},
+		{
+			name:      "ambiguous keys",
+			data:      map[string]interface{}{"welcomeMessage": "camel", "Welcome-Message": "kebab"},
+			ambiguous: []string{"Welcome-Message", "welcomeMessage"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := NewYAMLSource(test.data, "")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source.fuzzy = true
+
+			var config struct {
+				WelcomeMessage string
+			}
+
+			err = source.Read(&config)
+
+			if test.ambiguous != nil {
+				var ambiguousErr AmbiguousKeyError
+
+				if !errors.As(err, &ambiguousErr) || !reflect.DeepEqual(ambiguousErr.Candidates, test.ambiguous) {
+					t.Errorf("expected the keys %v to be ambiguous, got %v", test.ambiguous, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.WelcomeMessage != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, config.WelcomeMessage)
+			}
+		})
+	}
+}
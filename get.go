@@ -0,0 +1,63 @@
+package confusing
+
+import "fmt"
+
+type KeyNotFoundError struct {
+	Key string
+}
+
+func (k KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key not found: %s", k.Key)
+}
+
+// Get reads the value stored at key into a fresh T
+// A KeyNotFoundError is returned when the source is a KeyedSource that doesn't hold the key
+// A DecodeError is returned when the value can't be converted to T (e.g. "abc" or 1.5 read into an int)
+func Get[T any](source Source, key string) (T, error) {
+	var value T
+
+	if keyed, ok := source.(KeyedSource); ok && !keyed.Has(key) {
+		return value, KeyNotFoundError{Key: key}
+	}
+
+	err := source.ReadKey(key, &value)
+
+	return value, err
+}
+
+// MustGet is like Get but panics if the value can't be read
+func MustGet[T any](source Source, key string) T {
+	value, err := Get[T](source, key)
+
+	if err != nil {
+		panic(fmt.Errorf("confusing: failed to read %q (%T) from %s source: %w", key, value, source.Type(), err))
+	}
+
+	return value
+}
+
+// GetOr is like Get but returns fallback if the value is missing or can't be converted to T
+func GetOr[T any](source Source, key string, fallback T) T {
+	value, err := Get[T](source, key)
+
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
+
+// Load acquires a source through NewSource and reads it into a fresh T, which must be a struct
+func Load[T any](opts ...Options) (T, error) {
+	var value T
+
+	source, err := NewSource(opts...)
+
+	if err != nil {
+		return value, err
+	}
+
+	err = source.Read(&value)
+
+	return value, err
+}
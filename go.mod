@@ -2,6 +2,8 @@ module github.com/Pyrodash/confusing
 
 go 1.21
 
-require gopkg.in/yaml.v3 v3.0.1
-
-require github.com/joho/godotenv v1.5.1 // indirect
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/joho/godotenv v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+)
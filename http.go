@@ -0,0 +1,273 @@
+package confusing
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const HTTPSourceType SourceType = "http"
+
+const defaultPollInterval = 30 * time.Second
+
+var contentTypes = map[string]SourceType{
+	"application/json":   JSONSourceType,
+	"text/json":          JSONSourceType,
+	"application/yaml":   YAMLSourceType,
+	"application/x-yaml": YAMLSourceType,
+	"text/yaml":          YAMLSourceType,
+	"text/x-yaml":        YAMLSourceType,
+	"application/toml":   TOMLSourceType,
+	"text/toml":          TOMLSourceType,
+}
+
+type HTTPSourceOptions struct {
+	URL        string
+	Convention string
+	Strict     bool
+	FuzzyKeys  bool
+	// Registry resolves the convention of the format of the document, the default registry being used when it's nil
+	Registry *Registry
+	// BearerToken takes precedence over Username and Password, which are sent using basic auth
+	BearerToken string
+	Username    string
+	Password    string
+	Header      http.Header
+	// RootCAs verifies the certificate of the server hosting the document, like CONFIG_HTTP_CA_FILE
+	RootCAs *x509.CertPool
+	// Client replaces the default client, which trusts RootCAs and gives up on a fetch after 30 seconds
+	Client *http.Client
+	// PollInterval is the interval at which Watch fetches the document, defaulting to 30 seconds
+	PollInterval time.Duration
+}
+
+// HTTPSource reads a YAML, JSON or TOML document served over HTTP
+// The format is picked from the Content-Type of the response, or from the extension of the URL
+type HTTPSource struct {
+	remoteSource
+	opts   HTTPSourceOptions
+	client *http.Client
+	// held while fetching, since the validators are updated along with the data
+	fetching sync.Mutex
+	// validators of the last response, sent to avoid downloading the document when it didn't change
+	etag         string
+	lastModified string
+}
+
+// Fetch downloads the document if it changed since the last fetch, and reports whether it did
+func (s *HTTPSource) Fetch(ctx context.Context) (bool, error) {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.opts.URL, nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	for name, values := range s.opts.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	if len(s.opts.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+s.opts.BearerToken)
+	} else if len(s.opts.Username) > 0 {
+		req.SetBasicAuth(s.opts.Username, s.opts.Password)
+	}
+
+	if len(s.etag) > 0 {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	if len(s.lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", s.lastModified)
+	}
+
+	res, err := s.client.Do(req)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s: unexpected status %s", s.opts.URL, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return false, err
+	}
+
+	typ, err := s.documentType(res)
+
+	if err != nil {
+		return false, err
+	}
+
+	doc, err := DecodeDocument(s.opts.URL, typ, body)
+
+	if err != nil {
+		return false, err
+	}
+
+	source, err := newMapSource(s.registry, typ, doc.Data, s.opts.Convention)
+
+	if err != nil {
+		return false, err
+	}
+
+	source.strict = s.opts.Strict
+	source.fuzzy = s.opts.FuzzyKeys
+	source.positions = doc.Positions
+
+	s.swap(source)
+	s.etag = res.Header.Get("ETag")
+	s.lastModified = res.Header.Get("Last-Modified")
+
+	return true, nil
+}
+
+func (s *HTTPSource) documentType(res *http.Response) (SourceType, error) {
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+
+	if err == nil {
+		if typ, ok := contentTypes[mediaType]; ok {
+			return typ, nil
+		}
+	}
+
+	u, err := url.Parse(s.opts.URL)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch typ := s.registry.sourceTypeForExt(path.Ext(u.Path)); typ {
+	case YAMLSourceType, JSONSourceType, TOMLSourceType:
+		return typ, nil
+	}
+
+	return "", fmt.Errorf("%s: can't infer the format of the document from %q", s.opts.URL, res.Header.Get("Content-Type"))
+}
+
+// Watch polls the document, using the validators of the last response so that unchanged documents aren't downloaded
+func (s *HTTPSource) Watch(ctx context.Context, onChange func(err error)) error {
+	interval := s.opts.PollInterval
+
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			changed, err := s.Fetch(ctx)
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err != nil || changed {
+				onChange(err)
+			}
+		}
+	}
+}
+
+// NewHTTPSource is like NewHTTPSourceContext, without a deadline for the first fetch
+func NewHTTPSource(opts HTTPSourceOptions) (*HTTPSource, error) {
+	return NewHTTPSourceContext(context.Background(), opts)
+}
+
+// NewHTTPSourceContext fetches the document once, failing if it can't be read
+func NewHTTPSourceContext(ctx context.Context, opts HTTPSourceOptions) (*HTTPSource, error) {
+	client := opts.Client
+
+	if client == nil {
+		client = newRemoteClient(opts.RootCAs, 30*time.Second)
+	}
+
+	source := &HTTPSource{
+		remoteSource: remoteSource{typ: HTTPSourceType, registry: registryOrDefault(opts.Registry)},
+		opts:         opts,
+		client:       client,
+	}
+
+	if _, err := source.Fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// BuildHTTPSource is like BuildHTTPSourceContext, without a deadline for the first fetch
+func BuildHTTPSource(opts SourceOptions) (Source, error) {
+	return BuildHTTPSourceContext(context.Background(), opts)
+}
+
+// BuildHTTPSourceContext reads the URL from the file path, and the credentials from the following environment variables:
+// CONFIG_HTTP_TOKEN, CONFIG_HTTP_USERNAME, CONFIG_HTTP_PASSWORD, CONFIG_HTTP_CA_FILE and CONFIG_HTTP_POLL_INTERVAL
+func BuildHTTPSourceContext(ctx context.Context, opts SourceOptions) (Source, error) {
+	if !isHTTPURL(opts.FilePath) {
+		return nil, errors.New("the file path of an http source must be an http(s) URL")
+	}
+
+	httpOpts := HTTPSourceOptions{
+		URL:         opts.FilePath,
+		Convention:  opts.Convention,
+		Strict:      opts.Strict,
+		FuzzyKeys:   opts.FuzzyKeys,
+		Registry:    opts.Registry,
+		BearerToken: os.Getenv("CONFIG_HTTP_TOKEN"),
+		Username:    os.Getenv("CONFIG_HTTP_USERNAME"),
+		Password:    os.Getenv("CONFIG_HTTP_PASSWORD"),
+	}
+
+	if interval := os.Getenv("CONFIG_HTTP_POLL_INTERVAL"); len(interval) > 0 {
+		var err error
+
+		httpOpts.PollInterval, err = time.ParseDuration(interval)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if caFile := os.Getenv("CONFIG_HTTP_CA_FILE"); len(caFile) > 0 {
+		var err error
+
+		if httpOpts.RootCAs, err = loadRootCAs(caFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewHTTPSourceContext(ctx, httpOpts)
+}
+
+func isHTTPURL(filePath string) bool {
+	return strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://")
+}
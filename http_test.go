@@ -0,0 +1,294 @@
+package confusing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type httpTestConfig struct {
+	Database struct {
+		Host string
+		Port int
+	}
+}
+
+// httpTestServer serves a document which can be replaced while the test runs, along with an ETag of its version
+type httpTestServer struct {
+	mutex       sync.Mutex
+	body        string
+	contentType string
+	version     int
+	notModified int
+}
+
+func (h *httpTestServer) set(body string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.body = body
+	h.version++
+}
+
+func (h *httpTestServer) notModifiedCount() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.notModified
+}
+
+func (h *httpTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	etag := strconv.Quote("v" + strconv.Itoa(h.version))
+
+	if r.Header.Get("If-None-Match") == etag {
+		h.notModified++
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+
+	if len(h.contentType) > 0 {
+		w.Header().Set("Content-Type", h.contentType)
+	}
+
+	_, _ = w.Write([]byte(h.body))
+}
+
+func TestHTTPSourceFetch(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{name: "yaml content type", path: "/config", contentType: "application/yaml", body: "database:\n  host: db1\n  port: 5432\n"},
+		{name: "json content type", path: "/config", contentType: "application/json; charset=utf-8", body: `{"database": {"host": "db1", "port": 5432}}`},
+		{name: "toml extension", path: "/config.toml", contentType: "text/plain", body: "[database]\nhost = \"db1\"\nport = 5432\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(&httpTestServer{body: test.body, contentType: test.contentType})
+			defer server.Close()
+
+			source, err := NewHTTPSource(HTTPSourceOptions{URL: server.URL + test.path})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var config httpTestConfig
+
+			if err = source.Read(&config); err != nil {
+				t.Fatal(err)
+			}
+
+			if config.Database.Host != "db1" || config.Database.Port != 5432 {
+				t.Errorf("got %+v", config)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     HTTPSourceOptions
+		expected func(r *http.Request) bool
+	}{
+		{
+			name: "bearer token",
+			opts: HTTPSourceOptions{BearerToken: "secret", Username: "ignored"},
+			expected: func(r *http.Request) bool {
+				return r.Header.Get("Authorization") == "Bearer secret"
+			},
+		},
+		{
+			name: "basic auth",
+			opts: HTTPSourceOptions{Username: "user", Password: "pass"},
+			expected: func(r *http.Request) bool {
+				username, password, ok := r.BasicAuth()
+
+				return ok && username == "user" && password == "pass"
+			},
+		},
+		{
+			name: "header",
+			opts: HTTPSourceOptions{Header: http.Header{"X-Api-Key": {"key"}}},
+			expected: func(r *http.Request) bool {
+				return r.Header.Get("X-Api-Key") == "key"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !test.expected(r) {
+					w.WriteHeader(http.StatusUnauthorized)
+
+					return
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			test.opts.URL = server.URL
+
+			if _, err := NewHTTPSource(test.opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceNotModified(t *testing.T) {
+	handler := &httpTestServer{body: `{"database": {"host": "db1"}}`, contentType: "application/json"}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHTTPSource(HTTPSourceOptions{URL: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := source.Fetch(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed || handler.notModifiedCount() != 1 {
+		t.Errorf("expected the unchanged document not to be downloaded again, changed: %v, 304 responses: %d", changed, handler.notModifiedCount())
+	}
+
+	handler.set(`{"database": {"host": "db2"}}`)
+
+	if changed, err = source.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var config httpTestConfig
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || config.Database.Host != "db2" {
+		t.Errorf("expected the new document to be read, changed: %v, got %+v", changed, config)
+	}
+}
+
+func TestHTTPSourceWatch(t *testing.T) {
+	handler := &httpTestServer{body: `{"database": {"host": "db1"}}`, contentType: "application/json"}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewHTTPSource(HTTPSourceOptions{URL: server.URL, PollInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := make(chan error, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- source.Watch(ctx, func(err error) {
+			changes <- err
+		})
+	}()
+
+	handler.set(`{"database": {"host": "db2"}}`)
+
+	select {
+	case err = <-changes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the change wasn't reported")
+	}
+
+	var config httpTestConfig
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Database.Host != "db2" {
+		t.Errorf("got %+v", config)
+	}
+
+	cancel()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to return context.Canceled, got %v", err)
+	}
+}
+
+func TestHTTPSourceWatchClientTimeout(t *testing.T) {
+	var slow atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	source, err := NewHTTPSource(HTTPSourceOptions{
+		URL:          server.URL,
+		Client:       &http.Client{Timeout: 20 * time.Millisecond},
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var timeouts atomic.Int32
+	done := make(chan error)
+
+	go func() {
+		// timeouts of the client are reported rather than stopping the watch
+		done <- source.Watch(ctx, func(err error) {
+			if err != nil && timeouts.Add(1) == 2 {
+				cancel()
+			}
+		})
+	}()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to keep running until the context is canceled, got %v after %d timeouts", err, timeouts.Load())
+	}
+}
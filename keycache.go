@@ -0,0 +1,47 @@
+package confusing
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// keyCacheSize bounds the number of keys memoized by each normalizer, in case keys are built dynamically
+const keyCacheSize = 4096
+
+// keyCache memoizes the keys normalized by a built-in normalizer, since the same keys are normalized on every read
+type keyCache struct {
+	entries sync.Map
+	size    atomic.Int64
+}
+
+// keyCacheEntry remembers the acronyms a key was normalized with, since registering acronyms changes how keys are split
+type keyCacheEntry struct {
+	acronyms   *acronymTable
+	normalized string
+}
+
+// normalize returns the memoized normalization of key, normalizing it with fn the first time or when the acronyms changed
+func (c *keyCache) normalize(acronyms *acronymTable, key string, fn func(acronyms *acronymTable, key string) string) string {
+	if entry, ok := c.entries.Load(key); ok && entry.(keyCacheEntry).acronyms == acronyms {
+		return entry.(keyCacheEntry).normalized
+	}
+
+	normalized := fn(acronyms, key)
+
+	if c.size.Add(1) > keyCacheSize {
+		c.reset()
+	}
+
+	c.entries.Store(key, keyCacheEntry{acronyms: acronyms, normalized: normalized})
+
+	return normalized
+}
+
+func (c *keyCache) reset() {
+	c.entries.Range(func(key, _ interface{}) bool {
+		c.entries.Delete(key)
+		return true
+	})
+
+	c.size.Store(0)
+}
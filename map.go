@@ -1,30 +1,50 @@
 package confusing
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
+	"io"
+	"math"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	YAMLSourceType SourceType = "yaml"
 	JSONSourceType            = "json"
+	TOMLSourceType            = "toml"
 )
 
 // YAML and JSON sources are always attempted first because they are the most specific
 
 type MapSource struct {
+	// registry holding the aliases and the logger of the source, along with the plans of the structs it reads
+	registry   *Registry
 	typ        SourceType
 	data       map[string]interface{}
 	normalizer KeyNormalizer
+	strict     bool
+	// matches keys by their canonical form when they aren't found as is
+	fuzzy bool
+	// the file the data was read from, which Save writes back to
+	filePath string
+	// the document the data was decoded from, kept to preserve comments, ordering and styles when saving (YAML only)
+	node *yaml.Node
+	// positions of the normalized keys in the file, indexed by their dotted path
+	positions map[string]Position
 }
 
 type callbackFunc func()
 
 type mapQueueItem struct {
+	key      string
 	source   reflect.Value
 	target   reflect.Value
 	callback callbackFunc
@@ -36,33 +56,80 @@ func (i *mapQueueItem) complete() {
 	}
 }
 
-func (s *MapSource) getKeyFromMap(rootMap map[string]interface{}, key string) interface{} {
+// lookupKeyInMap returns the value stored at key, and whether the key exists at all
+func (s *MapSource) lookupKeyInMap(rootMap map[string]interface{}, key string) (interface{}, bool) {
+	value, _, ok, _ := s.resolveKey(rootMap, "", key)
+
+	return value, ok
+}
+
+// resolveKey returns the value stored at key, the normalized key as it's written in the map, and whether the key exists at all
+// Keys of rootMap are relative to parentKey, which is only used to report ambiguous keys
+func (s *MapSource) resolveKey(rootMap map[string]interface{}, parentKey string, key string) (interface{}, string, bool, error) {
 	var value interface{}
 
 	value = rootMap
 
 	if key == "" {
-		return value
+		return value, key, true, nil
 	}
 
-	key = s.normalizer.Normalize(key)
+	return s.resolveNormalizedKey(rootMap, parentKey, s.normalizer.Normalize(key))
+}
+
+// resolveNormalizedKey is like resolveKey, for a key which is already normalized
+func (s *MapSource) resolveNormalizedKey(rootMap map[string]interface{}, parentKey string, key string) (interface{}, string, bool, error) {
+	var value interface{}
+
+	value = rootMap
 	parts := strings.Split(key, ".")
 
-	for _, part := range parts {
-		if m, ok := value.(map[string]interface{}); ok {
-			value = m[part]
-		} else {
-			return nil
+	for i, part := range parts {
+		m, ok := value.(map[string]interface{})
+
+		if !ok {
+			return nil, key, false, nil
+		}
+
+		match, ok, err := s.matchKey(m, concatenateKeys(parentKey, strings.Join(parts[:i], ".")), part)
+
+		if err != nil || !ok {
+			return nil, key, false, err
 		}
+
+		parts[i] = match
+		value = m[match]
 	}
 
-	return value
+	return value, strings.Join(parts, "."), true, nil
+}
+
+func (s *MapSource) readMapPrimitive(ctx context.Context, rootSourceValue reflect.Value, rootTargetValue reflect.Value) error {
+	return s.readMapKey(ctx, "", rootSourceValue, rootTargetValue)
 }
 
-func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetValue reflect.Value) error {
-	queue := []mapQueueItem{{source: rootSourceValue, target: rootTargetValue}}
+func (s *MapSource) readMapKey(ctx context.Context, rootKey string, rootSourceValue reflect.Value, rootTargetValue reflect.Value) error {
+	queue := []mapQueueItem{{key: rootKey, source: rootSourceValue, target: rootTargetValue}}
+	var unknownKeys []UnknownKey
+	var errs []error
+
+	// deprecated keys which were read in place of another key, and thus aren't unknown
+	aliasKeys := make(map[string]struct{})
+
+	// values that can't be read are skipped, and reported once the rest of the target has been read
+	mismatch := func(item mapQueueItem, targetType reflect.Type) {
+		errs = append(errs, DecodeError{
+			Key:      item.key,
+			Position: s.position(item.key),
+			Message:  fmt.Sprintf("can't read %s into %s", describeValue(item.source.Interface()), targetType),
+		})
+	}
 
 	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		item := queue[0]
 		queue = queue[1:]
 
@@ -87,7 +154,23 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 			}
 		}
 
-		if sourceType.ConvertibleTo(targetType) {
+		if isNumberKind(sourceType.Kind()) && isNumberKind(targetType.Kind()) {
+			value, ok := convertNumber(item.source, targetType)
+
+			if !ok {
+				// the number doesn't fit in the target exactly
+				mismatch(item, targetType)
+				continue
+			}
+
+			item.target.Elem().Set(value)
+			item.complete()
+
+			continue
+		}
+
+		// numbers are convertible to strings, but as the character they encode
+		if sourceType.ConvertibleTo(targetType) && !isNumberKind(sourceType.Kind()) {
 			item.target.Elem().Set(item.source.Convert(targetType))
 			item.complete()
 
@@ -102,7 +185,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 
 				if err != nil {
 					// invalid boolean value
-					// do nothing
+					mismatch(item, targetType)
 					continue
 				}
 
@@ -111,7 +194,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 				item.target.Elem().SetBool(item.source.Float() > 0)
 			default:
 				// source type can't be converted to bool
-				// do nothing
+				mismatch(item, targetType)
 				continue
 			}
 		case reflect.Slice:
@@ -123,6 +206,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 					queue = append(
 						queue,
 						mapQueueItem{
+							key:    concatenateKeys(item.key, strconv.Itoa(i)),
 							source: item.source.Index(i).Elem(),
 							target: newSlice.Index(i).Addr(),
 						},
@@ -131,6 +215,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 
 				item.target.Elem().Set(newSlice)
 			} else {
+				mismatch(item, targetType)
 				continue
 			}
 		case reflect.Map:
@@ -151,6 +236,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 					newValuePtr := reflect.New(valueType)
 
 					queue = append(queue, mapQueueItem{
+						key:    concatenateKeys(item.key, fmt.Sprint(k.Interface())),
 						source: k,
 						target: newKeyPtr,
 						callback: func() {
@@ -159,6 +245,7 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 					})
 
 					queue = append(queue, mapQueueItem{
+						key:    concatenateKeys(item.key, fmt.Sprint(k.Interface())),
 						source: reflect.ValueOf(v.Interface()),
 						target: newValuePtr,
 						callback: func() {
@@ -171,69 +258,260 @@ func (s *MapSource) readMapPrimitive(rootSourceValue reflect.Value, rootTargetVa
 
 				item.target.Elem().Set(newMap)
 			} else {
+				mismatch(item, targetType)
 				continue
 			}
 		case reflect.Struct:
 			if m, ok := item.source.Interface().(map[string]interface{}); ok {
-				reader, isReader := item.target.Interface().(Reader)
+				isReader, err := readCustom(ctx, item.target, &MapSource{registry: s.registry, typ: s.typ, data: m, normalizer: s.normalizer, fuzzy: s.fuzzy})
+
+				if err != nil {
+					// errors from custom readers always break execution
+					// if you want your custom reader to remain fault-tolerant, do not return the errors you get from calling the configSource
+					return err
+				}
 
-				if isReader {
-					err := reader.ReadConfig(&MapSource{typ: s.typ, data: m})
+				if !isReader {
+					plan := s.registry.structPlanFor(targetType, s.typ, s.normalizer)
 
-					if err != nil {
-						// errors from custom readers always break execution
-						// if you want your custom reader to remain fault-tolerant, do not return the errors you get from calling the configSource
-						return err
-					}
-				} else {
-					for i := 0; i < targetType.NumField(); i++ {
-						field := targetType.Field(i)
-						childKey := processStructField(field)
+					for _, field := range plan.fields {
+						var childSourceValue interface{}
+						var matchedKey string
+						var err error
+
+						// keys given by a tag named after the source are looked up as is
+						if field.verbatim {
+							childSourceValue, matchedKey = m[field.key], field.key
+						} else {
+							childSourceValue, matchedKey, _, err = s.resolveNormalizedKey(m, item.key, field.normalizedKey)
+						}
+
+						childPath := concatenateKeys(item.key, matchedKey)
+
+						if err == nil {
+							childSourceValue, childPath, err = s.resolveAliases(m, item.key, field.aliases, childPath, childSourceValue, aliasKeys)
+						}
 
-						if childKey == "" {
+						if err != nil {
+							errs = append(errs, err)
 							continue
 						}
 
-						childSourceValue := s.getKeyFromMap(m, childKey)
+						// nested keys may still be read from their registered aliases when their parent isn't set
+						if childSourceValue == nil && s.registry.hasRegisteredAliasesUnder(s.normalizer, childPath) {
+							childSourceValue = map[string]interface{}{}
+						}
 
 						if childSourceValue != nil {
 							childValue := reflect.ValueOf(childSourceValue)
 
 							queue = append(queue, mapQueueItem{
+								key:    childPath,
 								source: childValue,
-								target: item.target.Elem().Field(i).Addr(),
+								target: item.target.Elem().Field(field.index).Addr(),
 							})
 						}
 					}
+
+					if s.strict {
+						unknownKeys = append(unknownKeys, s.findUnknownKeys(item.key, m, plan.knownKeys)...)
+					}
 				}
 			} else {
+				mismatch(item, targetType)
 				continue
 			}
 		default:
 			// unsupported data type
+			mismatch(item, targetType)
 			continue
 		}
 
 		item.complete()
 	}
 
-	return nil
+	if len(aliasKeys) > 0 {
+		filtered := unknownKeys[:0]
+
+		for _, unknownKey := range unknownKeys {
+			if _, ok := aliasKeys[unknownKey.Key]; !ok {
+				filtered = append(filtered, unknownKey)
+			}
+		}
+
+		unknownKeys = filtered
+	}
+
+	if len(unknownKeys) > 0 {
+		errs = append(errs, UnknownKeysError{Keys: unknownKeys})
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return errors.Join(errs...)
+}
+
+// findUnknownKeys reports the keys of m that aren't part of known, suggesting the closest known key for each of them
+// The maps holding dotted keys (e.g. database for a field tagged database.host) are checked against the rest of the keys
+func (s *MapSource) findUnknownKeys(parentKey string, m map[string]interface{}, known knownKeys) []UnknownKey {
+	var unknownKeys []UnknownKey
+	var candidates []string
+
+	canonicalKeys := make(map[string]knownKeys)
+
+	for key, children := range known {
+		candidates = append(candidates, key)
+
+		// keys of fields win over the parents of dotted keys, which are checked further
+		if existing, ok := canonicalKeys[canonicalKey(key)]; !ok || existing != nil {
+			canonicalKeys[canonicalKey(key)] = children
+		}
+	}
+
+	sort.Strings(candidates)
+
+	for key, value := range m {
+		absoluteKey := concatenateKeys(parentKey, key)
+		children, ok := known[key]
+
+		if !ok && s.fuzzy {
+			children, ok = canonicalKeys[canonicalKey(key)]
+		}
+
+		if ok {
+			if nested, isMap := value.(map[string]interface{}); isMap && children != nil {
+				unknownKeys = append(unknownKeys, s.findUnknownKeys(absoluteKey, nested, children)...)
+			}
+
+			continue
+		}
+
+		unknownKeys = append(unknownKeys, UnknownKey{
+			Key:        absoluteKey,
+			Suggestion: closestKey(key, candidates),
+			Position:   s.position(absoluteKey),
+		})
+	}
+
+	sort.Slice(unknownKeys, func(i, j int) bool {
+		return unknownKeys[i].Key < unknownKeys[j].Key
+	})
+
+	return unknownKeys
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// convertNumber converts a number to the target type, unless it would lose information (e.g. 1.5 into an int, or 300 into an int8)
+func convertNumber(value reflect.Value, targetType reflect.Type) (reflect.Value, bool) {
+	target := reflect.New(targetType).Elem()
+
+	switch {
+	case target.CanFloat():
+		var f float64
+
+		switch {
+		case value.CanInt():
+			f = float64(value.Int())
+		case value.CanUint():
+			f = float64(value.Uint())
+		default:
+			f = value.Float()
+		}
+
+		if target.OverflowFloat(f) {
+			return reflect.Value{}, false
+		}
+
+		target.SetFloat(f)
+	case target.CanInt():
+		var i int64
+
+		switch {
+		case value.CanInt():
+			i = value.Int()
+		case value.CanUint():
+			if value.Uint() > math.MaxInt64 {
+				return reflect.Value{}, false
+			}
+
+			i = int64(value.Uint())
+		default:
+			f := value.Float()
+
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return reflect.Value{}, false
+			}
+
+			i = int64(f)
+		}
+
+		if target.OverflowInt(i) {
+			return reflect.Value{}, false
+		}
+
+		target.SetInt(i)
+	default:
+		var u uint64
+
+		switch {
+		case value.CanInt():
+			if value.Int() < 0 {
+				return reflect.Value{}, false
+			}
+
+			u = uint64(value.Int())
+		case value.CanUint():
+			u = value.Uint()
+		default:
+			f := value.Float()
+
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return reflect.Value{}, false
+			}
+
+			u = uint64(f)
+		}
+
+		if target.OverflowUint(u) {
+			return reflect.Value{}, false
+		}
+
+		target.SetUint(u)
+	}
+
+	return target, true
 }
 
 func (s *MapSource) ReadKey(key string, target interface{}) error {
+	return s.ReadKeyContext(context.Background(), key, target)
+}
+
+func (s *MapSource) ReadKeyContext(ctx context.Context, key string, target interface{}) error {
 	targetValue := reflect.ValueOf(target)
 
 	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
 		return errors.New("target must be a non-nil pointer")
 	}
 
-	val := s.getKeyFromMap(s.data, key)
-	sourceValue := reflect.ValueOf(val)
+	val, key, _, err := s.resolveKey(s.data, "", key)
 
-	return s.readMapPrimitive(sourceValue, targetValue)
+	if err != nil {
+		return err
+	}
+
+	return s.readMapKey(ctx, key, reflect.ValueOf(val), targetValue)
 }
 
 func (s *MapSource) Read(target interface{}) error {
+	return s.ReadContext(context.Background(), target)
+}
+
+func (s *MapSource) ReadContext(ctx context.Context, target interface{}) error {
 	targetValue := reflect.ValueOf(target)
 
 	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
@@ -246,25 +524,57 @@ func (s *MapSource) Read(target interface{}) error {
 		return errors.New("target must be a struct")
 	}
 
-	return s.readMapPrimitive(reflect.ValueOf(s.data), targetValue)
+	return s.readMapPrimitive(ctx, reflect.ValueOf(s.data), targetValue)
 }
 
-func (s *MapSource) Type() SourceType {
-	return s.typ
+func (s *MapSource) Has(key string) bool {
+	_, ok := s.lookupKeyInMap(s.data, key)
+
+	return ok
 }
 
-func NewYAMLSource(data map[string]interface{}, convention string) (*MapSource, error) {
-	normalizer, err := NormalizerForSourceType(convention, YAMLSourceType)
+func (s *MapSource) Keys(prefix string) []string {
+	value, _ := s.lookupKeyInMap(s.data, prefix)
+	m, ok := value.(map[string]interface{})
 
-	if err != nil {
-		return nil, err
+	if !ok {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Position returns the position of key in the file the source was read from, when it's known
+// Items of arrays are indexed by their position in the array (e.g. oauth2.0.key)
+func (s *MapSource) Position(key string) (Position, bool) {
+	position, ok := s.positions[s.normalizer.Normalize(key)]
+
+	return position, ok
+}
+
+// position looks up a key which is already normalized, falling back to the file alone
+func (s *MapSource) position(key string) Position {
+	if position, ok := s.positions[key]; ok {
+		return position
 	}
 
-	return &MapSource{
-		typ:        YAMLSourceType,
-		data:       data,
-		normalizer: normalizer,
-	}, nil
+	return Position{File: s.filePath}
+}
+
+func (s *MapSource) Type() SourceType {
+	return s.typ
+}
+
+func NewYAMLSource(data map[string]interface{}, convention string) (*MapSource, error) {
+	return newMapSource(nil, YAMLSourceType, data, convention)
 }
 
 func BuildYAMLSource(opts SourceOptions) (Source, error) {
@@ -281,29 +591,43 @@ func BuildYAMLSource(opts SourceOptions) (Source, error) {
 	defer file.Close()
 
 	var data map[string]interface{}
+	var node yaml.Node
 
 	d := yaml.NewDecoder(file)
-	err = d.Decode(&data)
+	err = d.Decode(&node)
 
-	if err != nil {
+	if errors.Is(err, io.EOF) {
 		return nil, err
 	}
 
-	return NewYAMLSource(data, opts.Convention)
-}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.FilePath, err)
+	}
 
-func NewJSONSource(data map[string]interface{}, convention string) (*MapSource, error) {
-	normalizer, err := NormalizerForSourceType(convention, JSONSourceType)
+	err = node.Decode(&data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.FilePath, err)
+	}
+
+	source, err := newMapSource(opts.Registry, YAMLSourceType, data, opts.Convention)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &MapSource{
-		typ:        JSONSourceType,
-		data:       data,
-		normalizer: normalizer,
-	}, nil
+	source.node = &node
+	source.positions = yamlPositions(opts.FilePath, &node)
+
+	source.strict = opts.Strict
+	source.fuzzy = opts.FuzzyKeys
+	source.filePath = opts.FilePath
+
+	return source, nil
+}
+
+func NewJSONSource(data map[string]interface{}, convention string) (*MapSource, error) {
+	return newMapSource(nil, JSONSourceType, data, convention)
 }
 
 func BuildJSONSource(opts SourceOptions) (Source, error) {
@@ -311,22 +635,88 @@ func BuildJSONSource(opts SourceOptions) (Source, error) {
 		opts.FilePath = "config.json"
 	}
 
-	file, err := os.Open(opts.FilePath)
+	content, err := os.ReadFile(opts.FilePath)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
+	var data map[string]interface{}
+
+	err = json.Unmarshal(content, &data)
+
+	if err != nil {
+		return nil, jsonDecodeError(opts.FilePath, content, err)
+	}
+
+	source, err := newMapSource(opts.Registry, JSONSourceType, data, opts.Convention)
+
+	if err != nil {
+		return nil, err
+	}
+
+	source.strict = opts.Strict
+	source.fuzzy = opts.FuzzyKeys
+	source.filePath = opts.FilePath
+	source.positions, err = jsonPositions(opts.FilePath, content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+func NewTOMLSource(data map[string]interface{}, convention string) (*MapSource, error) {
+	return newMapSource(nil, TOMLSourceType, data, convention)
+}
+
+func BuildTOMLSource(opts SourceOptions) (Source, error) {
+	if len(opts.FilePath) == 0 {
+		opts.FilePath = "config.toml"
+	}
 
 	var data map[string]interface{}
 
-	d := json.NewDecoder(file)
-	err = d.Decode(&data)
+	_, err := toml.DecodeFile(opts.FilePath, &data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := newMapSource(opts.Registry, TOMLSourceType, normalizeTOMLValue(data).(map[string]interface{}), opts.Convention)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return NewJSONSource(data, opts.Convention)
+	source.strict = opts.Strict
+	source.fuzzy = opts.FuzzyKeys
+	source.filePath = opts.FilePath
+
+	return source, nil
+}
+
+// normalizeTOMLValue converts arrays of tables, which are decoded as []map[string]interface{}, to []interface{} like the other formats
+func normalizeTOMLValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for k, v := range val {
+			val[k] = normalizeTOMLValue(v)
+		}
+	case []interface{}:
+		for i, v := range val {
+			val[i] = normalizeTOMLValue(v)
+		}
+	case []map[string]interface{}:
+		items := make([]interface{}, len(val))
+
+		for i, v := range val {
+			items[i] = normalizeTOMLValue(v)
+		}
+
+		return items
+	}
+
+	return value
 }
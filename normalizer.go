@@ -2,7 +2,6 @@ package confusing
 
 import (
 	"fmt"
-	"os"
 	"strings"
 )
 
@@ -10,18 +9,31 @@ const (
 	SnakeCaseConvention      = "snake"
 	CamelCaseConvention      = "camel"
 	UpperSnakeCaseConvention = "upper_snake"
+	KebabCaseConvention      = "kebab"
+	PascalCaseConvention     = "pascal"
+	LowerDotCaseConvention   = "lower_dot"
 )
 
-var normalizers = map[string]KeyNormalizer{
-	SnakeCaseConvention:      &SnakeCaseNormalizer{},
-	CamelCaseConvention:      &CamelCaseNormalizer{},
-	UpperSnakeCaseConvention: &UpperSnakeCaseNormalizer{},
+// newBuiltinNormalizers returns the built-in conventions, splitting words with the acronyms of the registry
+func newBuiltinNormalizers(r *Registry) map[string]KeyNormalizer {
+	return map[string]KeyNormalizer{
+		SnakeCaseConvention:      &SnakeCaseNormalizer{builtinNormalizer{registry: r}},
+		CamelCaseConvention:      &CamelCaseNormalizer{builtinNormalizer{registry: r}},
+		UpperSnakeCaseConvention: &UpperSnakeCaseNormalizer{builtinNormalizer{registry: r}},
+		KebabCaseConvention:      &KebabCaseNormalizer{builtinNormalizer{registry: r}},
+		PascalCaseConvention:     &PascalCaseNormalizer{builtinNormalizer{registry: r}},
+		LowerDotCaseConvention:   &LowerDotCaseNormalizer{builtinNormalizer{registry: r}},
+	}
 }
 
-var sourceConventions = map[string]string{
-	EnvSourceType:  UpperSnakeCaseConvention,
-	YAMLSourceType: SnakeCaseConvention,
-	JSONSourceType: CamelCaseConvention,
+var builtinSourceConventions = map[SourceType]string{
+	EnvSourceType:    UpperSnakeCaseConvention,
+	YAMLSourceType:   SnakeCaseConvention,
+	JSONSourceType:   CamelCaseConvention,
+	TOMLSourceType:   SnakeCaseConvention,
+	ConsulSourceType: SnakeCaseConvention,
+	VaultSourceType:  SnakeCaseConvention,
+	EtcdSourceType:   SnakeCaseConvention,
 }
 
 type UnknownConventionError struct {
@@ -32,71 +44,182 @@ func (u UnknownConventionError) Error() string {
 	return fmt.Sprintf("unknown convention: %s", u.Convention)
 }
 
+// InvalidConventionError is returned when a normalizer registered as a convention doesn't round-trip a key
+type InvalidConventionError struct {
+	Convention string
+	Key        string
+	Normalized string
+	Reason     string
+}
+
+func (i InvalidConventionError) Error() string {
+	return fmt.Sprintf("convention %s normalizes %s to %q, %s", i.Convention, i.Key, i.Normalized, i.Reason)
+}
+
+// conventionSampleKeys are shaped like the keys built from struct fields, which every convention must round-trip
+var conventionSampleKeys = []string{
+	"Host",
+	"WelcomeMessage",
+	"Database.Host",
+	"Database.MaxOpenConns",
+	"HTTPServer.ReadTimeout",
+	"UserID",
+	"OAuth2Providers",
+	"Replicas3",
+}
+
 type KeyNormalizer interface {
 	Normalize(key string) string
 }
 
-type SnakeCaseNormalizer struct{}
+// validateNormalizer checks that a normalizer only changes the case and the separators of the words of a key,
+// and that normalizing a key twice doesn't change it, since normalized keys are compared to keys normalized again
+func validateNormalizer(convention string, normalizer KeyNormalizer) error {
+	for _, key := range conventionSampleKeys {
+		normalized := normalizer.Normalize(key)
+		err := InvalidConventionError{Convention: convention, Key: key, Normalized: normalized}
+
+		switch {
+		case len(normalized) == 0:
+			err.Reason = "which is empty"
+		case canonicalKey(strings.ReplaceAll(normalized, ".", "")) != canonicalKey(strings.ReplaceAll(key, ".", "")):
+			err.Reason = "which doesn't contain the same words"
+		case normalizer.Normalize(normalized) != normalized:
+			err.Reason = fmt.Sprintf("which is normalized again to %q", normalizer.Normalize(normalized))
+		default:
+			continue
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// builtinNormalizer memoizes the keys of a built-in normalizer, which are split with the acronyms of its registry
+// (or of the default registry when it's nil, as for normalizers created by hand)
+type builtinNormalizer struct {
+	registry *Registry
+	keys     keyCache
+}
+
+func (n *builtinNormalizer) normalize(key string, fn func(acronyms *acronymTable, key string) string) string {
+	return n.keys.normalize(registryOrDefault(n.registry).acronyms.Load(), key, fn)
+}
+
+type SnakeCaseNormalizer struct {
+	builtinNormalizer
+}
 
 func (n *SnakeCaseNormalizer) Normalize(key string) string {
-	return camelToSnake(key, true)
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		return acronyms.splitWords(key, '_', false)
+	})
 }
 
-type UpperSnakeCaseNormalizer struct{}
+// UpperSnakeCaseNormalizer flattens keys, so the parts of a key are split separately and joined with underscores
+type UpperSnakeCaseNormalizer struct {
+	builtinNormalizer
+}
 
-// Normalize todo: Optimize this process
 func (n *UpperSnakeCaseNormalizer) Normalize(key string) string {
-	parts := strings.Split(key, ".")
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		var b strings.Builder
 
-	for i, part := range parts {
-		parts[i] = strings.ToUpper(camelToSnake(part, false))
-	}
+		b.Grow(len(key) + len(key)/2)
+
+		for i := 0; ; i++ {
+			part, rest, found := strings.Cut(key, ".")
+
+			if i > 0 {
+				b.WriteByte('_')
+			}
 
-	key = strings.Join(parts, "_")
+			b.WriteString(acronyms.splitWords(part, '_', true))
 
-	return key
+			if !found {
+				break
+			}
+
+			key = rest
+		}
+
+		return b.String()
+	})
 }
 
-type CamelCaseNormalizer struct{}
+type CamelCaseNormalizer struct {
+	builtinNormalizer
+}
 
 func (n *CamelCaseNormalizer) Normalize(key string) string {
-	parts := strings.Split(key, ".")
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		parts := strings.Split(key, ".")
 
-	for i, part := range parts {
-		parts[i] = lcfirst(part)
-	}
+		for i, part := range parts {
+			parts[i] = acronyms.lcfirstWord(part)
+		}
 
-	return strings.Join(parts, ".")
+		return strings.Join(parts, ".")
+	})
 }
 
-func SetConventionForSourceType(sourceType SourceType, convention string) {
-	sourceConventions[sourceType] = convention
+type KebabCaseNormalizer struct {
+	builtinNormalizer
 }
 
-func GetNormalizer(convention string) KeyNormalizer {
-	return normalizers[convention]
+func (n *KebabCaseNormalizer) Normalize(key string) string {
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		return acronyms.splitWords(key, '-', false)
+	})
 }
 
-func GetConventionForSourceType(sourceType SourceType) string {
-	convention := sourceConventions[sourceType]
-	conventionEnvVar := fmt.Sprintf("%s_CONVENTION", strings.ToUpper(sourceType))
+type PascalCaseNormalizer struct {
+	builtinNormalizer
+}
+
+func (n *PascalCaseNormalizer) Normalize(key string) string {
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		parts := strings.Split(key, ".")
 
-	return stringOrDefault(os.Getenv(conventionEnvVar), convention)
+		for i, part := range parts {
+			if len(part) > 0 {
+				parts[i] = ucfirst(part)
+			}
+		}
+
+		return strings.Join(parts, ".")
+	})
 }
 
-func NormalizerForSourceType(convention string, sourceType SourceType) (KeyNormalizer, error) {
-	var normalizer KeyNormalizer
+// LowerDotCaseNormalizer separates words with dots, so every word of a key is a level of nesting (e.g. welcome.message)
+type LowerDotCaseNormalizer struct {
+	builtinNormalizer
+}
 
-	if len(convention) > 0 {
-		normalizer = GetNormalizer(convention)
-	} else {
-		convention = GetConventionForSourceType(sourceType)
-		normalizer = GetNormalizer(convention)
-	}
+func (n *LowerDotCaseNormalizer) Normalize(key string) string {
+	return n.normalize(key, func(acronyms *acronymTable, key string) string {
+		return acronyms.splitWords(key, '.', false)
+	})
+}
 
-	if normalizer == nil {
-		return nil, UnknownConventionError{Convention: convention}
-	}
+func SetConventionForSourceType(sourceType SourceType, convention string) {
+	defaultRegistry.SetConventionForSourceType(sourceType, convention)
+}
+
+// RegisterConvention makes a normalizer available under a name in the default registry
+func RegisterConvention(name string, normalizer KeyNormalizer) error {
+	return defaultRegistry.RegisterConvention(name, normalizer)
+}
 
-	return normalizer, nil
+func GetNormalizer(convention string) KeyNormalizer {
+	return defaultRegistry.GetNormalizer(convention)
+}
+
+func GetConventionForSourceType(sourceType SourceType) string {
+	return defaultRegistry.GetConventionForSourceType(sourceType)
+}
+
+func NormalizerForSourceType(convention string, sourceType SourceType) (KeyNormalizer, error) {
+	return defaultRegistry.NormalizerForSourceType(convention, sourceType)
 }
@@ -0,0 +1,319 @@
+package confusing
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// The normalizers are checked against the regular expressions keys were normalized with before splitWords, along with
+// the acronym handling of that time, which are copied here so that changes to the package don't change the reference
+
+// referenceAcronyms are the built-in acronyms, from the longest to the shortest
+var referenceAcronyms = func() []string {
+	words := []string{
+		"API", "CPU", "DB", "DNS", "GRPC", "HTML", "HTTP", "HTTPS", "ID", "IP", "JSON", "JWT", "OAuth", "SQL",
+		"SSH", "SSL", "TCP", "TLS", "TTL", "UDP", "UI", "URI", "URL", "UUID", "XML", "YAML",
+	}
+
+	sort.SliceStable(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+
+	return words
+}()
+
+// the regular expressions match newlines too, since keys split by splitWords don't treat them differently
+var (
+	referenceFirstCap = regexp.MustCompile("(?s)(.)([A-Z][a-z]+)")
+	referenceAllCap   = regexp.MustCompile("([a-z0-9])([A-Z])")
+)
+
+func referenceUcfirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+
+	return string(r)
+}
+
+func referenceLcfirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+
+	return string(r)
+}
+
+func referenceAcronymAt(s string, i int) string {
+	if i > 0 && unicode.IsUpper(rune(s[i-1])) {
+		return ""
+	}
+
+	return referenceMatchAcronym(s, i)
+}
+
+func referenceMatchAcronym(s string, i int) string {
+	for _, acronym := range referenceAcronyms {
+		if !strings.HasPrefix(s[i:], acronym) {
+			continue
+		}
+
+		end := i + len(acronym)
+
+		if end < len(s) && s[end] == 's' && (end+1 == len(s) || !unicode.IsLower(rune(s[end+1]))) {
+			end++
+		}
+
+		if end == len(s) || referenceIsWordBoundary(s, end) {
+			return s[i:end]
+		}
+	}
+
+	return ""
+}
+
+func referenceIsWordBoundary(s string, i int) bool {
+	r := rune(s[i])
+
+	if !unicode.IsLetter(r) {
+		return true
+	}
+
+	if !unicode.IsUpper(r) {
+		return false
+	}
+
+	return (i+1 < len(s) && unicode.IsLower(rune(s[i+1]))) || len(referenceMatchAcronym(s, i)) > 0
+}
+
+func referenceTitleAcronyms(key string) string {
+	var b strings.Builder
+
+	afterAcronym := false
+
+	for i := 0; i < len(key); {
+		var acronym string
+
+		if afterAcronym {
+			acronym = referenceMatchAcronym(key, i)
+		} else {
+			acronym = referenceAcronymAt(key, i)
+		}
+
+		afterAcronym = len(acronym) > 0
+
+		if afterAcronym {
+			end := i + len(acronym)
+
+			if i > 0 && strings.ContainsRune("_-.", rune(key[i-1])) && (end == len(key) || !unicode.IsLetter(rune(key[end]))) {
+				b.WriteString(acronym)
+			} else {
+				b.WriteString(referenceUcfirst(strings.ToLower(acronym)))
+			}
+
+			i = end
+
+			continue
+		}
+
+		b.WriteByte(key[i])
+		i++
+	}
+
+	return b.String()
+}
+
+func referenceLcfirstWord(key string) string {
+	if acronym := referenceAcronymAt(key, 0); len(acronym) > 0 {
+		return strings.ToLower(acronym) + key[len(acronym):]
+	}
+
+	end := 0
+
+	for end < len(key) && unicode.IsUpper(rune(key[end])) {
+		end++
+	}
+
+	if end > 1 && end < len(key) && unicode.IsLower(rune(key[end])) {
+		end--
+	}
+
+	if end <= 1 {
+		return referenceLcfirst(key)
+	}
+
+	return strings.ToLower(key[:end]) + key[end:]
+}
+
+func referenceCamelToSnake(input string, ensureLowercase bool) string {
+	input = referenceTitleAcronyms(input)
+	input = referenceFirstCap.ReplaceAllString(input, "${1}_${2}")
+	input = referenceAllCap.ReplaceAllString(input, "${1}_${2}")
+
+	if ensureLowercase {
+		input = strings.ToLower(input)
+	}
+
+	return input
+}
+
+// referenceNormalizers normalize keys the way the built-in conventions did before splitWords
+var referenceNormalizers = map[string]func(key string) string{
+	SnakeCaseConvention: func(key string) string {
+		return referenceCamelToSnake(key, true)
+	},
+	UpperSnakeCaseConvention: func(key string) string {
+		parts := strings.Split(key, ".")
+
+		for i, part := range parts {
+			parts[i] = strings.ToUpper(referenceCamelToSnake(part, false))
+		}
+
+		return strings.Join(parts, "_")
+	},
+	CamelCaseConvention: func(key string) string {
+		parts := strings.Split(key, ".")
+
+		for i, part := range parts {
+			parts[i] = referenceLcfirstWord(part)
+		}
+
+		return strings.Join(parts, ".")
+	},
+	KebabCaseConvention: func(key string) string {
+		return strings.ReplaceAll(referenceCamelToSnake(key, true), "_", "-")
+	},
+	PascalCaseConvention: func(key string) string {
+		parts := strings.Split(key, ".")
+
+		for i, part := range parts {
+			parts[i] = referenceUcfirst(part)
+		}
+
+		return strings.Join(parts, ".")
+	},
+	LowerDotCaseConvention: func(key string) string {
+		return strings.ReplaceAll(referenceCamelToSnake(key, true), "_", ".")
+	},
+}
+
+func TestNormalizers(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected map[string]string
+	}{
+		{
+			key: "HTTPServer",
+			expected: map[string]string{
+				SnakeCaseConvention:      "http_server",
+				UpperSnakeCaseConvention: "HTTP_SERVER",
+				CamelCaseConvention:      "httpServer",
+				KebabCaseConvention:      "http-server",
+				PascalCaseConvention:     "HTTPServer",
+				LowerDotCaseConvention:   "http.server",
+			},
+		},
+		{
+			key: "database.maxOpenConns",
+			expected: map[string]string{
+				SnakeCaseConvention:      "database.max_open_conns",
+				UpperSnakeCaseConvention: "DATABASE_MAX_OPEN_CONNS",
+				CamelCaseConvention:      "database.maxOpenConns",
+				KebabCaseConvention:      "database.max-open-conns",
+				PascalCaseConvention:     "Database.MaxOpenConns",
+				LowerDotCaseConvention:   "database.max.open.conns",
+			},
+		},
+		{
+			key: "OAuth2Providers",
+			expected: map[string]string{
+				SnakeCaseConvention:      "oauth2_providers",
+				UpperSnakeCaseConvention: "OAUTH2_PROVIDERS",
+				CamelCaseConvention:      "oauth2Providers",
+				KebabCaseConvention:      "oauth2-providers",
+				PascalCaseConvention:     "OAuth2Providers",
+				LowerDotCaseConvention:   "oauth2.providers",
+			},
+		},
+		{
+			key: "UserIDs",
+			expected: map[string]string{
+				SnakeCaseConvention:      "user_ids",
+				UpperSnakeCaseConvention: "USER_IDS",
+				CamelCaseConvention:      "userIDs",
+				KebabCaseConvention:      "user-ids",
+				PascalCaseConvention:     "UserIDs",
+				LowerDotCaseConvention:   "user.ids",
+			},
+		},
+		{
+			key: "welcome_message",
+			expected: map[string]string{
+				SnakeCaseConvention:      "welcome_message",
+				UpperSnakeCaseConvention: "WELCOME_MESSAGE",
+				CamelCaseConvention:      "welcome_message",
+				KebabCaseConvention:      "welcome-message",
+				PascalCaseConvention:     "Welcome_message",
+				LowerDotCaseConvention:   "welcome.message",
+			},
+		},
+		{
+			key: "a..b",
+			expected: map[string]string{
+				SnakeCaseConvention:      "a..b",
+				UpperSnakeCaseConvention: "A__B",
+				CamelCaseConvention:      "a..b",
+				KebabCaseConvention:      "a..b",
+				PascalCaseConvention:     "A..B",
+				LowerDotCaseConvention:   "a..b",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			for convention, expected := range test.expected {
+				if normalized := GetNormalizer(convention).Normalize(test.key); normalized != expected {
+					t.Errorf("%s normalizes %q to %q, expected %q", convention, test.key, normalized, expected)
+				}
+			}
+		})
+	}
+}
+
+func FuzzNormalizers(f *testing.F) {
+	for _, key := range conventionSampleKeys {
+		f.Add(key)
+	}
+
+	// keys with empty parts, which used to panic when their words were capitalized
+	for _, key := range []string{"", ".", ".x", "x.", "a..b", "Database..Host"} {
+		f.Add(key)
+	}
+
+	for _, key := range []string{"already_snake", "UPPER_SNAKE", "USER_ID", "kebab-case", "HTTPServer2Port", "Ünïcode.Kéy", "tab\tNew\nLine"} {
+		f.Add(key)
+	}
+
+	f.Fuzz(func(t *testing.T, key string) {
+		for convention, reference := range referenceNormalizers {
+			expected := reference(key)
+
+			// the first call normalizes the key and the second one reads it from the cache
+			for i := 0; i < 2; i++ {
+				if normalized := GetNormalizer(convention).Normalize(key); normalized != expected {
+					t.Fatalf("%s normalizes %q to %q, expected %q", convention, key, normalized, expected)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package confusing
+
+import (
+	"reflect"
+	"strings"
+)
+
+// structPlan describes how the fields of a struct are read by a source, so that its tags aren't parsed and its keys
+// aren't normalized again on every read
+type structPlan struct {
+	fields []fieldPlan
+	// normalized keys and aliases of every field, which strict mode doesn't report
+	knownKeys knownKeys
+}
+
+// knownKeys is a tree of the keys a struct may hold, split on dots since dotted keys are nested in maps
+// Keys of fields map to nil, since the keys under them are checked when the field is read
+type knownKeys map[string]knownKeys
+
+// add adds the parts of a key to the tree
+func (k knownKeys) add(parts ...string) {
+	children, ok := k[parts[0]]
+
+	if len(parts) == 1 {
+		k[parts[0]] = nil
+		return
+	}
+
+	// the key is nested under the key of another field
+	if ok && children == nil {
+		return
+	}
+
+	if children == nil {
+		children = make(knownKeys)
+		k[parts[0]] = children
+	}
+
+	children.add(parts[1:]...)
+}
+
+type fieldPlan struct {
+	index int
+	// key of the field, relative to its parent
+	key string
+	// whether the key was given by a tag named after the source, in which case it's used as is
+	verbatim bool
+	// key normalized by the normalizer of the plan, or the key itself when it's verbatim
+	normalizedKey string
+	// aliases given by the config tag, which are relative to the parent like the key
+	aliases []string
+}
+
+// registries cache plans by struct type, source type and normalizer, since tags named after a source only apply to it
+type planKey struct {
+	typ        reflect.Type
+	sourceType SourceType
+	normalizer KeyNormalizer
+}
+
+// structPlanFor returns the plan of a struct type, building it the first time it's read by a source of the given type
+func (r *Registry) structPlanFor(typ reflect.Type, sourceType SourceType, normalizer KeyNormalizer) *structPlan {
+	// normalizers which can't be used as map keys (e.g. structs holding a slice) aren't cached
+	if !reflect.TypeOf(normalizer).Comparable() {
+		return buildStructPlan(typ, sourceType, normalizer)
+	}
+
+	key := planKey{typ: typ, sourceType: sourceType, normalizer: normalizer}
+
+	if plan, ok := r.plans.Load(key); ok {
+		return plan.(*structPlan)
+	}
+
+	plan, _ := r.plans.LoadOrStore(key, buildStructPlan(typ, sourceType, normalizer))
+
+	return plan.(*structPlan)
+}
+
+// resetPlans discards the cached plans and alias tables, whose keys are outdated when the way keys are normalized changes
+func (r *Registry) resetPlans() {
+	r.plans.Range(func(key, _ interface{}) bool {
+		r.plans.Delete(key)
+		return true
+	})
+
+	r.resetAliasTables()
+}
+
+func buildStructPlan(typ reflect.Type, sourceType SourceType, normalizer KeyNormalizer) *structPlan {
+	plan := &structPlan{knownKeys: make(knownKeys)}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key, verbatim := processSourceField(field, sourceType)
+
+		if key == "" {
+			continue
+		}
+
+		fp := fieldPlan{
+			index:         i,
+			key:           key,
+			verbatim:      verbatim,
+			normalizedKey: key,
+			aliases:       fieldAliases(field),
+		}
+
+		if verbatim {
+			plan.knownKeys.add(key)
+		} else {
+			fp.normalizedKey = normalizer.Normalize(key)
+			plan.knownKeys.add(strings.Split(fp.normalizedKey, ".")...)
+		}
+
+		for _, alias := range fp.aliases {
+			plan.knownKeys.add(strings.Split(normalizer.Normalize(alias), ".")...)
+		}
+
+		plan.fields = append(plan.fields, fp)
+	}
+
+	return plan
+}
+
+// aliasTable holds the aliases registered through RegisterAlias, keyed by the normalized key they're registered for
+type aliasTable struct {
+	aliases map[string][]string
+	// normalized keys under which aliases are registered, e.g. database and database.pool for database.pool.size
+	parents map[string]struct{}
+}
+
+// aliasTableFor returns the registered aliases as seen by a normalizer, building the table the first time it's used
+func (r *Registry) aliasTableFor(normalizer KeyNormalizer) *aliasTable {
+	cacheable := reflect.TypeOf(normalizer).Comparable()
+
+	if cacheable {
+		if table, ok := r.aliasTables.Load(normalizer); ok {
+			return table.(*aliasTable)
+		}
+	}
+
+	// the lock is held until the table is stored, so that a table built before an alias is registered isn't cached
+	r.aliasesMutex.RLock()
+	defer r.aliasesMutex.RUnlock()
+
+	table := &aliasTable{aliases: make(map[string][]string), parents: make(map[string]struct{})}
+
+	for key, keyAliases := range r.aliases {
+		normalizedKey := normalizer.Normalize(key)
+		table.aliases[normalizedKey] = append(table.aliases[normalizedKey], keyAliases...)
+
+		for i := strings.LastIndex(normalizedKey, "."); i > 0; i = strings.LastIndex(normalizedKey[:i], ".") {
+			table.parents[normalizedKey[:i]] = struct{}{}
+		}
+	}
+
+	if !cacheable {
+		return table
+	}
+
+	cached, _ := r.aliasTables.LoadOrStore(normalizer, table)
+
+	return cached.(*aliasTable)
+}
+
+// resetAliasTables discards the cached alias tables
+func (r *Registry) resetAliasTables() {
+	r.aliasTables.Range(func(key, _ interface{}) bool {
+		r.aliasTables.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,116 @@
+package confusing
+
+import (
+	"log/slog"
+	"testing"
+)
+
+type planBenchmarkDatabase struct {
+	Host     string
+	Port     int
+	Username string
+	Password string `config:"password,alias=pass"`
+	Name     string `config:"name"`
+}
+
+type planBenchmarkConfig struct {
+	WelcomeMessage string
+	HTTPPort       int
+	Debug          bool
+	Database       planBenchmarkDatabase
+	Replicas       []planBenchmarkDatabase
+	Tags           []string
+	RequestTimeout int `config:"request_timeout,alias=timeout"`
+}
+
+var planBenchmarkData = map[string]interface{}{
+	"welcome_message": "Hello world",
+	"http_port":       8080,
+	"debug":           true,
+	"database": map[string]interface{}{
+		"host":     "127.0.0.1",
+		"port":     5432,
+		"username": "jackie",
+		"pass":     "secret",
+		"name":     "confusing",
+	},
+	"replicas": []interface{}{
+		map[string]interface{}{"host": "10.0.0.1", "port": 5432},
+		map[string]interface{}{"host": "10.0.0.2", "port": 5432},
+	},
+	"tags":    []interface{}{"a", "b", "c"},
+	"timeout": 30,
+}
+
+// benchmarkRead reads the benchmark config from source, discarding the cached plans before every read when uncached is set
+func benchmarkRead(b *testing.B, source Source, uncached bool) {
+	// deprecated keys would be logged on every read
+	SetLogger(nil)
+	b.Cleanup(func() {
+		SetLogger(slog.Default())
+	})
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if uncached {
+			defaultRegistry.resetPlans()
+		}
+
+		var config planBenchmarkConfig
+
+		if err := source.Read(&config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMapSourceRead(b *testing.B) {
+	source, err := NewYAMLSource(planBenchmarkData, "")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		benchmarkRead(b, source, false)
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		benchmarkRead(b, source, true)
+	})
+}
+
+func BenchmarkEnvSourceRead(b *testing.B) {
+	vars := map[string]string{
+		"WELCOME_MESSAGE":   "Hello world",
+		"HTTP_PORT":         "8080",
+		"DEBUG":             "true",
+		"DATABASE_HOST":     "127.0.0.1",
+		"DATABASE_PORT":     "5432",
+		"DATABASE_USERNAME": "jackie",
+		"DATABASE_PASS":     "secret",
+		"DATABASE_NAME":     "confusing",
+		"REPLICAS":          `[{"host": "10.0.0.1", "port": 5432}, {"host": "10.0.0.2", "port": 5432}]`,
+		"TAGS":              "a,b,c",
+		"TIMEOUT":           "30",
+	}
+
+	for name, value := range vars {
+		b.Setenv(name, value)
+	}
+
+	source, err := NewEnvSource("")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		benchmarkRead(b, source, false)
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		benchmarkRead(b, source, true)
+	})
+}
@@ -0,0 +1,180 @@
+package confusing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Position locates a key in a config file
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// offsetPosition converts a byte offset in data to a line and a column
+func offsetPosition(file string, data []byte, offset int) Position {
+	offset = min(offset, len(data))
+	line := bytes.Count(data[:offset], []byte("\n"))
+	column := offset - (bytes.LastIndexByte(data[:offset], '\n') + 1)
+
+	return Position{File: file, Line: line + 1, Column: column + 1}
+}
+
+// jsonDecodeError prefixes syntax and type errors of encoding/json with the position they occurred at
+func jsonDecodeError(file string, data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%s: %w", offsetPosition(file, data, int(syntaxErr.Offset)), err)
+	}
+
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("%s: %w", offsetPosition(file, data, int(typeErr.Offset)), err)
+	}
+
+	return fmt.Errorf("%s: %w", file, err)
+}
+
+// yamlPositions maps the dotted path of every key in the node to the position of the key
+// Items of sequences are indexed by their position in the sequence
+func yamlPositions(file string, node *yaml.Node) map[string]Position {
+	positions := make(map[string]Position)
+
+	var walk func(key string, node *yaml.Node)
+
+	walk = func(key string, node *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(key, child)
+			}
+		case yaml.AliasNode:
+			walk(key, node.Alias)
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				keyNode := node.Content[i]
+				childKey := concatenateKeys(key, keyNode.Value)
+
+				positions[childKey] = Position{File: file, Line: keyNode.Line, Column: keyNode.Column}
+				walk(childKey, node.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				childKey := concatenateKeys(key, strconv.Itoa(i))
+
+				positions[childKey] = Position{File: file, Line: child.Line, Column: child.Column}
+				walk(childKey, child)
+			}
+		}
+	}
+
+	walk("", node)
+
+	return positions
+}
+
+type jsonContainer struct {
+	key      string
+	isObject bool
+	// objects alternate between keys and values
+	expectKey  bool
+	pendingKey string
+	index      int
+}
+
+// jsonPositions maps the dotted path of every key in the document to the position of the key
+// Items of arrays are indexed by their position in the array
+func jsonPositions(file string, data []byte) (map[string]Position, error) {
+	positions := make(map[string]Position)
+	lineOffsets := []int{0}
+
+	for i, b := range data {
+		if b == '\n' {
+			lineOffsets = append(lineOffsets, i+1)
+		}
+	}
+
+	positionAt := func(offset int) Position {
+		// skip the separators preceding the token
+		for offset < len(data) && bytes.IndexByte([]byte(" \t\r\n,:"), data[offset]) >= 0 {
+			offset++
+		}
+
+		line := sort.SearchInts(lineOffsets, offset+1) - 1
+
+		return Position{File: file, Line: line + 1, Column: offset - lineOffsets[line] + 1}
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	var stack []*jsonContainer
+
+	for {
+		offset := int(d.InputOffset())
+		token, err := d.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		delim, isDelim := token.(json.Delim)
+
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+
+			continue
+		}
+
+		var key string
+
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+
+			if parent.isObject && parent.expectKey {
+				parent.pendingKey = concatenateKeys(parent.key, token.(string))
+				parent.expectKey = false
+				positions[parent.pendingKey] = positionAt(offset)
+
+				continue
+			}
+
+			if parent.isObject {
+				key = parent.pendingKey
+				parent.expectKey = true
+			} else {
+				key = concatenateKeys(parent.key, strconv.Itoa(parent.index))
+				positions[key] = positionAt(offset)
+				parent.index++
+			}
+		}
+
+		if isDelim {
+			stack = append(stack, &jsonContainer{key: key, isObject: delim == '{', expectKey: delim == '{'})
+		}
+	}
+
+	return positions, nil
+}
@@ -0,0 +1,281 @@
+package confusing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds the source types, conventions, acronyms and aliases used to acquire and read sources, and is safe for
+// concurrent use
+// Registries are independent of each other, so registering a source or changing a convention in one doesn't affect the others
+type Registry struct {
+	mutex                 sync.RWMutex
+	sources               map[SourceType]ContextSourceBuilder
+	sourceTypeByExt       map[string]SourceType
+	sourceTypeByScheme    map[string]SourceType
+	reverseOrderedSources []SourceType
+	normalizers           map[string]KeyNormalizer
+	sourceConventions     map[SourceType]string
+	// acronyms is replaced rather than modified by RegisterAcronyms, so that keys can be normalized without locking
+	acronymsMutex sync.Mutex
+	acronyms      atomic.Pointer[acronymTable]
+	// aliases maps keys to the deprecated keys they used to be read from
+	aliasesMutex sync.RWMutex
+	aliases      map[string][]string
+	// alias tables are cached by normalizer, and discarded when an alias is registered
+	aliasTables sync.Map
+	plans       sync.Map
+	loggerMutex sync.RWMutex
+	logger      Logger
+}
+
+var defaultRegistry *Registry
+
+// the default registry is built on init, since the built-in builders refer to it
+func init() {
+	defaultRegistry = NewRegistry()
+}
+
+// UnknownSourceTypeError is returned when a source of a type which isn't registered is requested
+type UnknownSourceTypeError struct {
+	SourceType SourceType
+}
+
+func (u UnknownSourceTypeError) Error() string {
+	return fmt.Sprintf("unknown source type: %s", u.SourceType)
+}
+
+// NewRegistry returns a registry holding the built-in sources, conventions and acronyms, which logs warnings to slog.Default()
+func NewRegistry() *Registry {
+	r := &Registry{
+		sources:               maps.Clone(builtinSources),
+		sourceTypeByExt:       maps.Clone(builtinSourceTypeByExt),
+		sourceTypeByScheme:    maps.Clone(builtinSourceTypeByScheme),
+		reverseOrderedSources: slices.Clone(builtinReverseOrderedSources),
+		sourceConventions:     maps.Clone(builtinSourceConventions),
+		aliases:               make(map[string][]string),
+		logger:                slog.Default(),
+	}
+
+	r.normalizers = newBuiltinNormalizers(r)
+	r.RegisterAcronyms(builtinAcronyms...)
+
+	return r
+}
+
+// DefaultRegistry returns the registry used by the package-level functions, such as NewSource and RegisterSource
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// registryOrDefault returns the default registry when r is nil
+func registryOrDefault(r *Registry) *Registry {
+	if r == nil {
+		return defaultRegistry
+	}
+
+	return r
+}
+
+func (r *Registry) RegisterSource(typ string, builder SourceBuilder) {
+	r.RegisterSourceContext(typ, withContext(builder))
+}
+
+func (r *Registry) RegisterSourceContext(typ string, builder ContextSourceBuilder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.sources[typ]; !ok {
+		r.reverseOrderedSources = append(r.reverseOrderedSources, typ)
+	}
+
+	r.sources[typ] = builder
+	r.sourceTypeByExt["."+typ] = typ
+}
+
+func (r *Registry) SetConventionForSourceType(sourceType SourceType, convention string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sourceConventions[sourceType] = convention
+}
+
+// RegisterConvention makes a normalizer available under a name, which can then be used as the convention of a source
+// (e.g. through SourceOptions.Convention or the *_CONVENTION environment variables), after checking that it round-trips keys
+func (r *Registry) RegisterConvention(name string, normalizer KeyNormalizer) error {
+	if len(name) == 0 {
+		return errors.New("the name of a convention can't be empty")
+	}
+
+	if normalizer == nil {
+		return fmt.Errorf("the normalizer of convention %s can't be nil", name)
+	}
+
+	if err := validateNormalizer(name, normalizer); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.normalizers[name] = normalizer
+
+	return nil
+}
+
+func (r *Registry) GetNormalizer(convention string) KeyNormalizer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.normalizers[convention]
+}
+
+func (r *Registry) GetConventionForSourceType(sourceType SourceType) string {
+	r.mutex.RLock()
+	convention := r.sourceConventions[sourceType]
+	r.mutex.RUnlock()
+
+	conventionEnvVar := fmt.Sprintf("%s_CONVENTION", strings.ToUpper(sourceType))
+
+	return stringOrDefault(os.Getenv(conventionEnvVar), convention)
+}
+
+func (r *Registry) NormalizerForSourceType(convention string, sourceType SourceType) (KeyNormalizer, error) {
+	if len(convention) == 0 {
+		convention = r.GetConventionForSourceType(sourceType)
+	}
+
+	normalizer := r.GetNormalizer(convention)
+
+	if normalizer == nil {
+		return nil, UnknownConventionError{Convention: convention}
+	}
+
+	return normalizer, nil
+}
+
+// SourceTypeForFile infers the type of the source of a config file from its path, or returns an empty string if it's unknown
+func (r *Registry) SourceTypeForFile(filePath string) SourceType {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var typ SourceType
+	var ok bool
+
+	if scheme, _, found := strings.Cut(filePath, "://"); found && len(r.sourceTypeByScheme[scheme]) > 0 {
+		typ = r.sourceTypeByScheme[scheme]
+	} else if strings.HasPrefix(filepath.Base(filePath), ".env") {
+		typ = r.sourceTypeByExt[".env"]
+	} else {
+		ext := filepath.Ext(filePath)
+		typ, ok = r.sourceTypeByExt[ext]
+
+		if !ok {
+			typ = ext
+		}
+	}
+
+	_, ok = r.sources[typ]
+
+	if !ok {
+		typ = ""
+	}
+
+	return typ
+}
+
+// sourceTypeForExt returns the source type registered for a file extension (e.g. .yaml)
+func (r *Registry) sourceTypeForExt(ext string) SourceType {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.sourceTypeByExt[ext]
+}
+
+// NewSource acquires a source like the package-level NewSource, using the sources and conventions of the registry
+func (r *Registry) NewSource(optsSlice ...Options) (Source, error) {
+	return r.NewSourceContext(context.Background(), optsSlice...)
+}
+
+// NewSourceContext is like NewSource, giving up on remote sources once ctx is done
+func (r *Registry) NewSourceContext(ctx context.Context, optsSlice ...Options) (Source, error) {
+	sourceOptions := SourceOptions{
+		FilePath:   os.Getenv("CONFIG_PATH"),
+		Convention: os.Getenv("CONFIG_CONVENTION"),
+		EnvPrefix:  os.Getenv("CONFIG_ENV_PREFIX"),
+		Registry:   r,
+	}
+
+	sourceType := strings.ToLower(os.Getenv("CONFIG_TYPE"))
+
+	if len(optsSlice) > 0 {
+		sourceOptions.FilePath = stringOrDefault(sourceOptions.FilePath, optsSlice[0].SourceOptions.FilePath)
+		sourceOptions.Convention = stringOrDefault(sourceOptions.Convention, optsSlice[0].SourceOptions.Convention)
+		sourceOptions.EnvPrefix = stringOrDefault(sourceOptions.EnvPrefix, optsSlice[0].SourceOptions.EnvPrefix)
+		sourceOptions.Strict = optsSlice[0].SourceOptions.Strict
+		sourceOptions.FuzzyKeys = optsSlice[0].SourceOptions.FuzzyKeys
+		sourceType = stringOrDefault(sourceType, optsSlice[0].SourceType)
+	}
+
+	sourceOptions.Strict = parseBoolOrDefault(os.Getenv("CONFIG_STRICT"), sourceOptions.Strict)
+	sourceOptions.FuzzyKeys = parseBoolOrDefault(os.Getenv("CONFIG_FUZZY_KEYS"), sourceOptions.FuzzyKeys)
+
+	var subsetSources []SourceType
+
+	if len(sourceType) > 0 {
+		subsetSources = []SourceType{sourceType}
+	} else if len(sourceOptions.FilePath) > 0 {
+		inferredType := r.SourceTypeForFile(sourceOptions.FilePath)
+
+		if len(inferredType) > 0 {
+			subsetSources = []SourceType{inferredType}
+		}
+	}
+
+	// the builders are collected beforehand, since they may use the registry themselves
+	r.mutex.RLock()
+
+	if len(subsetSources) == 0 {
+		subsetSources = slices.Clone(r.reverseOrderedSources)
+	}
+
+	builders := make([]ContextSourceBuilder, len(subsetSources))
+
+	for i, typ := range subsetSources {
+		builders[i] = r.sources[typ]
+	}
+
+	r.mutex.RUnlock()
+
+	var source Source
+	var err error
+
+	for i := len(builders) - 1; i >= 0; i-- {
+		if builders[i] == nil {
+			err = UnknownSourceTypeError{SourceType: subsetSources[i]}
+			continue
+		}
+
+		source, err = builders[i](ctx, sourceOptions)
+
+		if err == nil {
+			return source, nil
+		}
+
+		// the remaining sources would fail the same way
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
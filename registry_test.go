@@ -0,0 +1,97 @@
+package confusing
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// registryTestLogger records the warnings it receives
+type registryTestLogger struct {
+	mutex    sync.Mutex
+	warnings []string
+}
+
+func (l *registryTestLogger) Warn(msg string, args ...any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.warnings = append(l.warnings, fmt.Sprint(append([]any{msg}, args...)...))
+}
+
+func (l *registryTestLogger) count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return len(l.warnings)
+}
+
+type registryTestConfig struct {
+	GraphQLServer string
+	Database      struct {
+		Host string
+	}
+}
+
+func TestRegistryIsolation(t *testing.T) {
+	registry := NewRegistry()
+	logger := &registryTestLogger{}
+	registry.SetLogger(logger)
+
+	defaultLogger := &registryTestLogger{}
+	SetLogger(defaultLogger)
+	t.Cleanup(func() {
+		SetLogger(slog.Default())
+	})
+
+	data := map[string]interface{}{
+		"graph_ql_server": "split",
+		"graphql_server":  "acronym",
+		"db_host":         "127.0.0.1",
+	}
+
+	read := func(registry *Registry) registryTestConfig {
+		source, err := newMapSource(registry, YAMLSourceType, data, "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var config registryTestConfig
+
+		if err = source.Read(&config); err != nil {
+			t.Fatal(err)
+		}
+
+		return config
+	}
+
+	// the plan of the struct is cached before the acronym is registered, and discarded once it is
+	if config := read(registry); config.GraphQLServer != "split" {
+		t.Errorf("expected GraphQLServer to be read from graph_ql_server, got %q", config.GraphQLServer)
+	}
+
+	registry.RegisterAcronyms("GraphQL")
+	registry.RegisterAlias("database.host", "db_host")
+
+	if config := read(registry); config.GraphQLServer != "acronym" || config.Database.Host != "127.0.0.1" {
+		t.Errorf("expected the acronym and the alias of the registry to be used, got %+v", config)
+	}
+
+	if config := read(nil); config.GraphQLServer != "split" || len(config.Database.Host) > 0 {
+		t.Errorf("expected the default registry to be unaffected, got %+v", config)
+	}
+
+	if logger.count() != 1 || defaultLogger.count() != 0 {
+		t.Errorf("expected the deprecated key to be logged by the logger of the registry, got %q and %q", logger.warnings, defaultLogger.warnings)
+	}
+
+	if normalized := registry.GetNormalizer(SnakeCaseConvention).Normalize("GraphQLServer"); normalized != "graphql_server" {
+		t.Errorf("expected graphql_server, got %s", normalized)
+	}
+
+	if normalized := GetNormalizer(SnakeCaseConvention).Normalize("GraphQLServer"); normalized != "graph_ql_server" {
+		t.Errorf("expected graph_ql_server, got %s", normalized)
+	}
+}
@@ -0,0 +1,121 @@
+package confusing
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WatchableSource is implemented by sources whose data can change while the application is running
+type WatchableSource interface {
+	Source
+	// Watch blocks until ctx is done, calling onChange with a nil error after the data of the source changed,
+	// or with the error which prevented it from being refreshed
+	Watch(ctx context.Context, onChange func(err error)) error
+}
+
+// remoteSource holds the data last fetched by a remote source, which is replaced as a whole when it changes
+type remoteSource struct {
+	typ      SourceType
+	registry *Registry
+	mutex    sync.RWMutex
+	current  *MapSource
+}
+
+func (s *remoteSource) source() *MapSource {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.current
+}
+
+func (s *remoteSource) swap(source *MapSource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.current = source
+}
+
+func (s *remoteSource) Read(target interface{}) error {
+	return s.source().Read(target)
+}
+
+func (s *remoteSource) ReadKey(key string, target interface{}) error {
+	return s.source().ReadKey(key, target)
+}
+
+func (s *remoteSource) ReadContext(ctx context.Context, target interface{}) error {
+	return s.source().ReadContext(ctx, target)
+}
+
+func (s *remoteSource) ReadKeyContext(ctx context.Context, key string, target interface{}) error {
+	return s.source().ReadKeyContext(ctx, key, target)
+}
+
+func (s *remoteSource) Has(key string) bool {
+	return s.source().Has(key)
+}
+
+func (s *remoteSource) Keys(prefix string) []string {
+	return s.source().Keys(prefix)
+}
+
+func (s *remoteSource) Position(key string) (Position, bool) {
+	return s.source().Position(key)
+}
+
+func (s *remoteSource) Type() SourceType {
+	return s.typ
+}
+
+// newMapSource builds a map source for data decoded from a document of the given type, resolving its convention with the registry
+func newMapSource(registry *Registry, typ SourceType, data map[string]interface{}, convention string) (*MapSource, error) {
+	registry = registryOrDefault(registry)
+	normalizer, err := registry.NormalizerForSourceType(convention, typ)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &MapSource{
+		registry:   registry,
+		typ:        typ,
+		data:       data,
+		normalizer: normalizer,
+	}, nil
+}
+
+// newRemoteClient builds the client of a remote source, verifying the certificate of the server against rootCAs instead of
+// the system roots when it's not nil
+// A zero timeout leaves requests unbounded, which sources holding streams or blocking queries open rely on
+func newRemoteClient(rootCAs *x509.CertPool, timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// loadRootCAs reads the PEM-encoded certificates of a CA file, such as the ones named by VAULT_CACERT and ETCDCTL_CACERT
+func loadRootCAs(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates found", caFile)
+	}
+
+	return pool, nil
+}
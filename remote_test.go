@@ -0,0 +1,51 @@
+package confusing
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoteClientRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	invalidFile := filepath.Join(dir, "invalid.pem")
+
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(invalidFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadRootCAs(invalidFile); err == nil {
+		t.Error("expected a file without certificates to be reported")
+	}
+
+	// the certificate of the server isn't signed by the system roots
+	if _, err := newRemoteClient(nil, time.Second).Get(server.URL); err == nil {
+		t.Error("expected the certificate of the server to be rejected")
+	}
+
+	rootCAs, err := loadRootCAs(caFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := newRemoteClient(rootCAs, time.Second).Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+}
@@ -0,0 +1,440 @@
+package confusing
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema emitted by GenerateJSONSchema
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Deprecated           bool               `json:"deprecated,omitempty"`
+	// Key is the dotted config key of the property before normalization, used to find it in other conventions
+	Key string `json:"x-confusing-key,omitempty"`
+	// Secret marks properties tagged with secret:"true", whose values are masked by Diff
+	Secret bool `json:"x-confusing-secret,omitempty"`
+	// Env is the name given by an env tag, which names the variable of the property (and prefixes those nested in it) whatever the source type
+	Env string `json:"x-confusing-env,omitempty"`
+	// SourceType is the type of source the schema was generated for, whose property names are normalized for other types when validating
+	SourceType SourceType `json:"x-confusing-source-type,omitempty"`
+
+	// a boolean schema accepts either everything or nothing, and is encoded as true or false
+	boolean *bool
+}
+
+func booleanSchema(value bool) *Schema {
+	return &Schema{boolean: &value}
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.boolean != nil {
+		return json.Marshal(*s.boolean)
+	}
+
+	type plainSchema Schema
+
+	return json.Marshal((*plainSchema)(s))
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var value bool
+
+	if err := json.Unmarshal(data, &value); err == nil {
+		*s = Schema{boolean: &value}
+
+		return nil
+	}
+
+	type plainSchema Schema
+
+	return json.Unmarshal(data, (*plainSchema)(s))
+}
+
+// GenerateJSONSchema describes target, a struct or a pointer to one, as it would be read by a source of the given type
+// Keys are normalized the same way the source would normalize them, and the following tags are honoured:
+// default, required ("true"), validate (required, min, max, len and oneof), description and secret ("true")
+func GenerateJSONSchema(target interface{}, convention string, sourceType SourceType) (*Schema, error) {
+	normalizer, err := NormalizerForSourceType(convention, sourceType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(target)
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("target must be a struct")
+	}
+
+	schema := generateSchema(t, sourceType, normalizer, "")
+	schema.Schema = JSONSchemaDraft
+	schema.SourceType = sourceType
+
+	return schema, nil
+}
+
+// keys of items of slices and values of maps are relative to the item itself, since they are read as a whole
+func generateSchema(t reflect.Type, sourceType SourceType, normalizer KeyNormalizer, key string) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// custom readers decide on their own how they are read
+	if isCustomReader(t) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := 0.0
+
+		return &Schema{Type: "integer", Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: generateSchema(t.Elem(), sourceType, normalizer, "")}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generateSchema(t.Elem(), sourceType, normalizer, "")}
+	case reflect.Struct:
+		schema := &Schema{
+			Type:                 "object",
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: booleanSchema(false),
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			childKey, verbatim := processSourceField(field, sourceType)
+
+			if childKey == "" {
+				continue
+			}
+
+			// the key of the schema is the generic one, even when a tag named after the source overrides it
+			absoluteKey := concatenateKeys(key, stringOrDefault(processStructField(field), childKey))
+			childSchema := generateSchema(field.Type, sourceType, normalizer, absoluteKey)
+			childSchema.Key = absoluteKey
+
+			// env files are named after env tags whatever the source type, and don't hold the fields skipped by env:"-"
+			if envName, verbatim := processSourceField(field, EnvSourceType); verbatim {
+				childSchema.Env = envName
+			} else if envName == "" {
+				childSchema.Env = "-"
+			}
+
+			required := applySchemaTags(childSchema, field)
+
+			parts := []string{childKey}
+
+			if !verbatim {
+				parts = strings.Split(normalizer.Normalize(childKey), ".")
+			}
+
+			parent, name := addSchemaProperty(schema, parts, childSchema)
+			aliases := fieldAliases(field)
+
+			// a key can't be required while it may still be set through one of its aliases
+			if required && len(aliases) == 0 {
+				parent.Required = append(parent.Required, name)
+			}
+
+			for _, alias := range aliases {
+				aliasSchema := *childSchema
+				aliasSchema.Key = concatenateKeys(key, alias)
+				aliasSchema.Env = ""
+				aliasSchema.Deprecated = true
+
+				addSchemaProperty(schema, strings.Split(normalizer.Normalize(alias), "."), &aliasSchema)
+			}
+		}
+
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+// addSchemaProperty adds a property at the path given by parts, returning the object holding it and its name
+// Keys such as config:"database.host" are nested in intermediate objects
+func addSchemaProperty(schema *Schema, parts []string, property *Schema) (*Schema, string) {
+	parent := schema
+
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent.Properties[part]
+
+		if !ok || child.Properties == nil {
+			child = &Schema{
+				Type:                 "object",
+				Properties:           map[string]*Schema{},
+				AdditionalProperties: booleanSchema(false),
+			}
+			parent.Properties[part] = child
+		}
+
+		parent = child
+	}
+
+	name := parts[len(parts)-1]
+	parent.Properties[name] = property
+
+	return parent, name
+}
+
+// renormalize returns a copy of the schema whose properties are named by normalizer after the keys they were generated from
+// key is the absolute key of the schema, which the keys of its properties start with
+func (s *Schema) renormalize(normalizer KeyNormalizer, key string) *Schema {
+	if s == nil || s.boolean != nil {
+		return s
+	}
+
+	renormalized := *s
+	renormalized.Items = s.Items.renormalize(normalizer, "")
+	renormalized.AdditionalProperties = s.AdditionalProperties.renormalize(normalizer, "")
+
+	if s.Properties != nil {
+		renormalized.Properties = map[string]*Schema{}
+		renormalized.Required = nil
+
+		s.renormalizeProperties(&renormalized, normalizer, key)
+	}
+
+	return &renormalized
+}
+
+// renormalizeProperties adds the properties of the schema to target, including those nested in the intermediate objects of
+// keys such as config:"database.host", which have no key of their own
+func (s *Schema) renormalizeProperties(target *Schema, normalizer KeyNormalizer, key string) {
+	var names []string
+
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+
+	// parents are added before the dotted keys nested in them
+	sort.Slice(names, func(i, j int) bool {
+		return s.Properties[names[i]].Key < s.Properties[names[j]].Key
+	})
+
+	for _, name := range names {
+		property := s.Properties[name]
+
+		if property.Key == "" {
+			if property.Properties != nil {
+				property.renormalizeProperties(target, normalizer, key)
+			}
+
+			continue
+		}
+
+		relativeKey := property.Key
+
+		if len(key) > 0 {
+			relativeKey = strings.TrimPrefix(relativeKey, key+".")
+		}
+
+		parts := strings.Split(normalizer.Normalize(relativeKey), ".")
+		parent, childName := addSchemaProperty(target, parts, property.renormalize(normalizer, property.Key))
+
+		if slices.Contains(s.Required, name) {
+			parent.Required = append(parent.Required, childName)
+		}
+	}
+}
+
+// isMap tells whether the schema describes a map, whose keys aren't named after fields
+func (s *Schema) isMap() bool {
+	return s != nil && s.Type == "object" && s.Properties == nil && s.AdditionalProperties != nil
+}
+
+// property returns the schema of the value stored at key, which is matched in any convention, or nil if it's unknown
+func (s *Schema) property(key string) *Schema {
+	if s == nil {
+		return nil
+	}
+
+	if s.isMap() {
+		return s.AdditionalProperties
+	}
+
+	if property, ok := s.Properties[key]; ok {
+		return property
+	}
+
+	canonical := canonicalKey(key)
+
+	for name, property := range s.Properties {
+		if canonicalKey(name) == canonical {
+			return property
+		}
+	}
+
+	return nil
+}
+
+// items returns the schema of the items of an array, or nil if it's unknown
+func (s *Schema) items() *Schema {
+	if s == nil {
+		return nil
+	}
+
+	return s.Items
+}
+
+// applySchemaTags reads the documentation and validation tags of the field into its schema, and reports whether it's required
+func applySchemaTags(schema *Schema, field reflect.StructField) bool {
+	schema.Description = field.Tag.Get("description")
+	schema.Secret, _ = strconv.ParseBool(field.Tag.Get("secret"))
+
+	if defaultValue, ok := field.Tag.Lookup("default"); ok {
+		schema.Default = parseSchemaValue(schema, defaultValue)
+	}
+
+	validate := field.Tag.Get("validate")
+
+	for _, rule := range strings.Split(validate, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(param, 64)
+
+			if err != nil {
+				continue
+			}
+
+			applySchemaLimit(schema, name, limit)
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, parseSchemaValue(schema, value))
+			}
+		}
+	}
+
+	return isRequiredField(field)
+}
+
+// isRequiredField reports whether the field is tagged with required:"true" or validate:"required"
+func isRequiredField(field reflect.StructField) bool {
+	if required, _ := strconv.ParseBool(field.Tag.Get("required")); required {
+		return true
+	}
+
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func applySchemaLimit(schema *Schema, name string, limit float64) {
+	minimum := name == "min" || name == "len"
+	maximum := name == "max" || name == "len"
+	length := int(limit)
+
+	switch schema.Type {
+	case "integer", "number":
+		if minimum {
+			schema.Minimum = &limit
+		}
+
+		if maximum {
+			schema.Maximum = &limit
+		}
+	case "string":
+		if minimum {
+			schema.MinLength = &length
+		}
+
+		if maximum {
+			schema.MaxLength = &length
+		}
+	case "array":
+		if minimum {
+			schema.MinItems = &length
+		}
+
+		if maximum {
+			schema.MaxItems = &length
+		}
+	}
+}
+
+// parseSchemaValue converts a value written in a tag to the type described by the schema
+func parseSchemaValue(schema *Schema, value string) interface{} {
+	switch schema.Type {
+	case "string":
+		return value
+	case "integer":
+		if valueInt, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return valueInt
+		}
+	case "number":
+		if valueFloat, err := strconv.ParseFloat(value, 64); err == nil {
+			return valueFloat
+		}
+	case "boolean":
+		if valueBool, err := strconv.ParseBool(value); err == nil {
+			return valueBool
+		}
+
+		if valueBool, err := parseBool(value); err == nil {
+			return valueBool
+		}
+	case "array":
+		var data []interface{}
+
+		if err := json.Unmarshal([]byte(value), &data); err == nil {
+			return data
+		}
+
+		items := strings.Split(value, ",")
+		data = make([]interface{}, len(items))
+
+		for i, item := range items {
+			data[i] = parseSchemaValue(schema.Items, strings.TrimSpace(item))
+		}
+
+		return data
+	default:
+		var data interface{}
+
+		if err := json.Unmarshal([]byte(value), &data); err == nil {
+			return data
+		}
+	}
+
+	return value
+}
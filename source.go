@@ -1,6 +1,9 @@
 package confusing
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type SourceType = string
 
@@ -10,13 +13,91 @@ type Source interface {
 	ReadKey(key string, target interface{}) error
 }
 
+// ContextSource is implemented by sources whose reads stop when their context is done, and which pass it to ContextReader types
+// It's kept separate from Source so that custom sources don't have to implement it
+type ContextSource interface {
+	Source
+	ReadContext(ctx context.Context, target interface{}) error
+	ReadKeyContext(ctx context.Context, key string, target interface{}) error
+}
+
+// ReadContext reads target from a source with a context, which is only checked beforehand if the source isn't a ContextSource
+func ReadContext(ctx context.Context, source Source, target interface{}) error {
+	if source, ok := source.(ContextSource); ok {
+		return source.ReadContext(ctx, target)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return source.Read(target)
+}
+
+// ReadKeyContext is like ReadContext, for a key of the source
+func ReadKeyContext(ctx context.Context, source Source, key string, target interface{}) error {
+	if source, ok := source.(ContextSource); ok {
+		return source.ReadKeyContext(ctx, key, target)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return source.ReadKey(key, target)
+}
+
+// KeyedSource is implemented by sources that can tell which keys they hold
+// It's kept separate from Source so that custom sources don't have to implement it
+type KeyedSource interface {
+	Source
+	// Has reports whether a value is set at the key, even if it's the zero value of its type
+	Has(key string) bool
+	// Keys lists the keys stored directly under prefix, as they are named in the source
+	Keys(prefix string) []string
+}
+
+// WritableSource is implemented by sources that can be modified and written back to their file
+type WritableSource interface {
+	Source
+	// Set stores value at key, creating the intermediate maps as needed
+	Set(key string, value interface{}) error
+	// Delete removes key, or returns a KeyNotFoundError if it doesn't exist
+	Delete(key string) error
+	// Save atomically writes the data back to the file it was read from
+	Save() error
+}
+
 type SourceOptions struct {
 	FilePath   string
 	Convention string
+	// Strict makes Read report the keys of the source that didn't map to any field of the target
+	Strict bool
+	// EnvPrefix is the key under which Read, ReadKey, Has and Keys look variables up, and strict mode looks for unconsumed
+	// ones (EnvSource only)
+	EnvPrefix string
+	// FuzzyKeys makes map sources match keys written in another convention, e.g. welcomeMessage for welcome_message
+	FuzzyKeys bool
+	// Registry resolves the convention of the source, defaulting to the default registry (it's set by Registry.NewSource)
+	Registry *Registry
 }
 
 type SourceBuilder = func(opts SourceOptions) (Source, error)
 
+// ContextSourceBuilder is like SourceBuilder, for sources which can be canceled while they are built (e.g. remote sources)
+type ContextSourceBuilder = func(ctx context.Context, opts SourceOptions) (Source, error)
+
+// withContext adapts a builder which doesn't take a context, which is only checked before calling it
+func withContext(builder SourceBuilder) ContextSourceBuilder {
+	return func(ctx context.Context, opts SourceOptions) (Source, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		return builder(opts)
+	}
+}
+
 type PrefixedSource struct {
 	source Source
 	prefix string
@@ -30,13 +111,42 @@ func (s *PrefixedSource) ReadKey(key string, target interface{}) error {
 	return s.source.ReadKey(fmt.Sprintf("%s.%s", s.prefix, key), target)
 }
 
+func (s *PrefixedSource) ReadContext(ctx context.Context, target interface{}) error {
+	return ReadKeyContext(ctx, s.source, s.prefix, target)
+}
+
+func (s *PrefixedSource) ReadKeyContext(ctx context.Context, key string, target interface{}) error {
+	return ReadKeyContext(ctx, s.source, fmt.Sprintf("%s.%s", s.prefix, key), target)
+}
+
+// keyedPrefixedSource is a PrefixedSource wrapping a KeyedSource, so that sources which can't tell their keys aren't treated as empty
+type keyedPrefixedSource struct {
+	*PrefixedSource
+	source KeyedSource
+}
+
+func (s *keyedPrefixedSource) Has(key string) bool {
+	return s.source.Has(concatenateKeys(s.prefix, key))
+}
+
+func (s *keyedPrefixedSource) Keys(prefix string) []string {
+	return s.source.Keys(concatenateKeys(s.prefix, prefix))
+}
+
 func (s *PrefixedSource) Type() SourceType {
 	return s.source.Type()
 }
 
+// PrefixSourceWith returns a source reading the keys of source under prefix, which is a KeyedSource if source is one
 func PrefixSourceWith(prefix string, source Source) Source {
-	return &PrefixedSource{
+	prefixed := &PrefixedSource{
 		source: source,
 		prefix: prefix,
 	}
+
+	if keyed, ok := source.(KeyedSource); ok {
+		return &keyedPrefixedSource{PrefixedSource: prefixed, source: keyed}
+	}
+
+	return prefixed
 }
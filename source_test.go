@@ -0,0 +1,72 @@
+package confusing
+
+import (
+	"reflect"
+	"testing"
+)
+
+// unkeyedTestSource is a custom source which can read keys but can't tell which ones it holds
+type unkeyedTestSource struct {
+	source Source
+}
+
+func (s unkeyedTestSource) Type() SourceType {
+	return "custom"
+}
+
+func (s unkeyedTestSource) Read(target interface{}) error {
+	return s.source.Read(target)
+}
+
+func (s unkeyedTestSource) ReadKey(key string, target interface{}) error {
+	return s.source.ReadKey(key, target)
+}
+
+func TestPrefixedSourceGet(t *testing.T) {
+	source, err := NewYAMLSource(map[string]interface{}{"db": map[string]interface{}{"port": 5432}}, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source Source
+		keyed  bool
+	}{
+		{name: "keyed source", source: source, keyed: true},
+		{name: "custom source", source: unkeyedTestSource{source}, keyed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefixed := PrefixSourceWith("db", test.source)
+
+			if _, keyed := prefixed.(KeyedSource); keyed != test.keyed {
+				t.Fatalf("expected the prefixed source to be keyed: %v", test.keyed)
+			}
+
+			port, err := Get[int](prefixed, "port")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if port != 5432 {
+				t.Errorf("expected 5432, got %d", port)
+			}
+
+			if !test.keyed {
+				return
+			}
+
+			if _, err = Get[int](prefixed, "host"); !reflect.DeepEqual(err, KeyNotFoundError{Key: "host"}) {
+				t.Errorf("expected a KeyNotFoundError, got %v", err)
+			}
+
+			if keys := prefixed.(KeyedSource).Keys(""); !reflect.DeepEqual(keys, []string{"port"}) {
+				t.Errorf("expected the keys under db, got %v", keys)
+			}
+		})
+	}
+}
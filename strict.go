@@ -0,0 +1,57 @@
+package confusing
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnknownKey is a key found in a source that didn't map to any field of the target
+type UnknownKey struct {
+	Key        string
+	Suggestion string
+	Position   Position
+}
+
+func (k UnknownKey) String() string {
+	key := k.Key
+
+	if k.Position.IsValid() {
+		key = fmt.Sprintf("%s (%s)", k.Key, k.Position)
+	}
+
+	if k.Suggestion == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s (did you mean %s?)", key, k.Suggestion)
+}
+
+// UnknownKeysError is returned by sources in strict mode after the whole target has been read
+type UnknownKeysError struct {
+	Keys []UnknownKey
+}
+
+func (u UnknownKeysError) Error() string {
+	keys := make([]string, len(u.Keys))
+
+	for i, key := range u.Keys {
+		keys[i] = key.String()
+	}
+
+	return fmt.Sprintf("unknown keys: %s", strings.Join(keys, ", "))
+}
+
+// DecodeError is a value of a source that couldn't be read into its target, which is reported after the rest of the target has been read
+type DecodeError struct {
+	Key      string
+	Position Position
+	Message  string
+}
+
+func (d DecodeError) Error() string {
+	if d.Position.File == "" {
+		return fmt.Sprintf("%s: %s", d.Key, d.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", d.Position, d.Key, d.Message)
+}
@@ -0,0 +1,60 @@
+package confusing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type strictTestConfig struct {
+	Host     string `config:"database.host"`
+	Timeout  int    `config:"database.pool.timeout,alias=database.pool.wait"`
+	Port     int
+	Replicas []struct {
+		Host string
+	}
+}
+
+func TestMapSourceStrict(t *testing.T) {
+	source, err := NewYAMLSource(map[string]interface{}{
+		"database": map[string]interface{}{
+			"host": "db1",
+			"hsot": "db2",
+			"pool": map[string]interface{}{
+				"wait":    30,
+				"timeuot": 10,
+			},
+		},
+		"port":     5432,
+		"prot":     5433,
+		"replicas": []interface{}{map[string]interface{}{"hots": "db3"}},
+	}, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source.strict = true
+
+	var config strictTestConfig
+	var unknownKeysErr UnknownKeysError
+
+	if err = source.Read(&config); !errors.As(err, &unknownKeysErr) {
+		t.Fatalf("expected an UnknownKeysError, got %v", err)
+	}
+
+	expected := []UnknownKey{
+		{Key: "database.hsot", Suggestion: "host"},
+		{Key: "database.pool.timeuot", Suggestion: "timeout"},
+		{Key: "prot", Suggestion: "port"},
+		{Key: "replicas.0.hots", Suggestion: "host"},
+	}
+
+	if !reflect.DeepEqual(unknownKeysErr.Keys, expected) {
+		t.Errorf("expected %v, got %v", expected, unknownKeysErr.Keys)
+	}
+
+	if config.Host != "db1" || config.Timeout != 30 || config.Port != 5432 {
+		t.Errorf("got %+v", config)
+	}
+}
@@ -1,29 +1,104 @@
 package confusing
 
 import (
-	"path/filepath"
 	"reflect"
-	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+// splitWords converts a camelCase key to snake_case in a single pass, separating its words with sep (which also replaces
+// its underscores) and converting it to uppercase or lowercase
+// A separator is inserted before a capital which follows a lowercase letter or a digit, or which starts a capitalized
+// word (e.g. the S of HTTPServer once HTTP is recognized as an acronym)
+func (t *acronymTable) splitWords(key string, sep byte, upper bool) string {
+	key = t.titleAcronyms(key)
 
-// converts camelCase to dot.notation
-func camelToSnake(input string, ensureLowercase bool) string {
-	input = matchFirstCap.ReplaceAllString(input, "${1}_${2}")
-	input = matchAllCap.ReplaceAllString(input, "${1}_${2}")
+	b := make([]byte, 0, len(key)+len(key)/2)
+	ascii := true
 
-	if ensureLowercase {
-		input = strings.ToLower(input)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+
+		if c >= utf8.RuneSelf {
+			ascii = false
+		}
+
+		if i > 0 && isUpperASCII(c) {
+			prev := key[i-1]
+
+			if isLowerASCII(prev) || isDigitASCII(prev) || (i+1 < len(key) && isLowerASCII(key[i+1])) {
+				b = append(b, sep)
+			}
+		}
+
+		switch {
+		case c == '_':
+			c = sep
+		case upper && isLowerASCII(c):
+			c -= 'a' - 'A'
+		case !upper && isUpperASCII(c):
+			c += 'a' - 'A'
+		}
+
+		b = append(b, c)
 	}
 
-	return input
+	// the case of other letters is converted as a whole, which is only needed for non-ASCII keys
+	if !ascii {
+		if upper {
+			return strings.ToUpper(string(b))
+		}
+
+		return strings.ToLower(string(b))
+	}
+
+	return string(b)
+}
+
+func isUpperASCII(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isLowerASCII(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isDigitASCII(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// converts a key of any of the built-in conventions back to camelCase, which every convention normalizes from
+// Acronyms are spelled as registered in the default registry
+func snakeToCamel(key string) string {
+	acronyms := defaultRegistry.acronyms.Load()
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+
+	for i, part := range parts {
+		// parts without lowercase letters (e.g. UPPER_SNAKE_CASE) are lowercased as a whole
+		if strings.ToUpper(part) == part {
+			part = strings.ToLower(part)
+		}
+
+		if i == 0 {
+			parts[i] = acronyms.lcfirstWord(part)
+		} else if spelling, ok := acronyms.acronymSpelling(strings.ToLower(part)); ok {
+			parts[i] = spelling
+		} else {
+			parts[i] = ucfirst(part)
+		}
+	}
+
+	return strings.Join(parts, "")
 }
 
 func ucfirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
 	r := []rune(s)
 	r[0] = unicode.ToUpper(r[0])
 
@@ -31,21 +106,34 @@ func ucfirst(s string) string {
 }
 
 func lcfirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
 	r := []rune(s)
 	r[0] = unicode.ToLower(r[0])
 
 	return string(r)
 }
 
+// concatenateKeys joins keys using the dot notation, skipping empty keys
 func concatenateKeys(keys ...string) string {
-	return strings.Join(keys, ".")
+	nonEmptyKeys := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if key != "" {
+			nonEmptyKeys = append(nonEmptyKeys, key)
+		}
+	}
+
+	return strings.Join(nonEmptyKeys, ".")
 }
 
 func parseBool(val string) (bool, error) {
 	switch strings.ToLower(val) {
-	case "1", "yes", "on":
+	case "1", "true", "yes", "on":
 		return true, nil
-	case "0", "no", "off":
+	case "0", "false", "no", "off":
 		return false, nil
 	}
 
@@ -62,8 +150,26 @@ func parseBoolOrDefault(val string, defaultValue bool) bool {
 	return boolValue
 }
 
+// processSourceField returns the key of a field for a source of the given type, and whether it bypasses the normalizer
+// A tag named after the type of the source (e.g. yaml:"dsn" or env:"DATABASE_URL") takes precedence over the config tag
+func processSourceField(field reflect.StructField, typ SourceType) (string, bool) {
+	if tag, ok := field.Tag.Lookup(typ); ok && len(typ) > 0 && field.IsExported() {
+		name, _, _ := strings.Cut(tag, ",")
+
+		if name == "-" {
+			return "", false
+		}
+
+		if name != "" {
+			return name, true
+		}
+	}
+
+	return processStructField(field), false
+}
+
 func processStructField(field reflect.StructField) string {
-	key := field.Tag.Get("config")
+	key, _ := parseConfigTag(field.Tag.Get("config"))
 
 	if key == "-" {
 		return ""
@@ -100,26 +206,57 @@ func stringOrDefault(key string, defaultValue string) string {
 	return key
 }
 
-func inferSourceTypeFromFilePath(filePath string) SourceType {
-	var typ SourceType
-	var ok bool
+// SourceTypeForFile infers the type of the source of a config file from its path, or returns an empty string if it's unknown
+func SourceTypeForFile(filePath string) SourceType {
+	return defaultRegistry.SourceTypeForFile(filePath)
+}
+
+// levenshtein computes the edit distance between two strings
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
 
-	if strings.HasPrefix(filePath, ".env") {
-		typ = sourceTypeByExt[".env"]
-	} else {
-		ext := filepath.Ext(filePath)
-		typ, ok = sourceTypeByExt[ext]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
 
-		if !ok {
-			typ = ext
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
 		}
+
+		prev, curr = curr, prev
 	}
 
-	_, ok = sources[typ]
+	return prev[len(rb)]
+}
+
+// closestKey returns the candidate that is the most similar to key, or an empty string if none of them are close enough
+func closestKey(key string, candidates []string) string {
+	best := ""
+	bestDistance := 0
+	maxDistance := max(2, len(key)/3)
+	lowerKey := strings.ToLower(key)
+
+	for _, candidate := range candidates {
+		distance := levenshtein(lowerKey, strings.ToLower(candidate))
 
-	if !ok {
-		typ = ""
+		if distance <= maxDistance && (best == "" || distance < bestDistance) {
+			best = candidate
+			bestDistance = distance
+		}
 	}
 
-	return typ
+	return best
 }
@@ -0,0 +1,468 @@
+package confusing
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const VaultSourceType SourceType = "vault"
+
+const defaultVaultPollInterval = time.Minute
+
+// failed renewals are retried after a second, doubling the delay after every failure up to this
+const maxVaultRenewalBackoff = time.Minute
+
+type VaultSourceOptions struct {
+	// Address of the Vault server, defaulting to https://127.0.0.1:8200
+	Address string
+	// Mount of the KV v2 secrets engine, defaulting to "secret"
+	Mount string
+	Path  string
+	// KeyPrefix is the key under which the data of the secret is mounted, e.g. "database" to read database.password
+	KeyPrefix  string
+	Namespace  string
+	Convention string
+	Strict     bool
+	FuzzyKeys  bool
+	// Registry resolves the convention the keys of the secret are written in, falling back to the default registry
+	Registry *Registry
+	// Token takes precedence over RoleID and SecretID, which are used to log in with AppRole
+	Token    string
+	RoleID   string
+	SecretID string
+	// RoleMount is the mount of the AppRole auth method, defaulting to "approle"
+	RoleMount string
+	// RootCAs verifies the certificate of the Vault server, like VAULT_CACERT
+	RootCAs *x509.CertPool
+	// Client replaces the default client, e.g. to authenticate with a client certificate, and ignores RootCAs
+	Client *http.Client
+	// PollInterval is the interval at which Watch reads the secret, defaulting to 1 minute
+	PollInterval time.Duration
+}
+
+type VaultError struct {
+	StatusCode int `json:"-"`
+	Errors     []string
+}
+
+func (v VaultError) Error() string {
+	if len(v.Errors) == 0 {
+		return fmt.Sprintf("vault: unexpected status %d", v.StatusCode)
+	}
+
+	return fmt.Sprintf("vault: %d: %s", v.StatusCode, strings.Join(v.Errors, ", "))
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+type vaultResponse struct {
+	Auth *vaultAuth      `json:"auth"`
+	Data json.RawMessage `json:"data"`
+}
+
+// VaultSource reads a secret of a KV v2 secrets engine, mounting its data under KeyPrefix
+// Since it only holds the secret, it's meant to be read after the source holding the rest of the config
+type VaultSource struct {
+	remoteSource
+	opts   VaultSourceOptions
+	client *http.Client
+	// held while fetching or authenticating, since the token and version are updated along with the data
+	fetching sync.Mutex
+	token    string
+	// time at which the token should be renewed, which is zero when it never expires
+	renewAt   time.Time
+	renewable bool
+	// number of renewals which failed since the token was last renewed
+	renewFailures int
+	version       int
+}
+
+func (s *VaultSource) usesAppRole() bool {
+	return len(s.opts.Token) == 0 && len(s.opts.RoleID) > 0
+}
+
+// request sends a request to the Vault API, decoding the response into out
+func (s *VaultSource) request(ctx context.Context, method string, path string, body interface{}, out *vaultResponse) error {
+	var reader *bytes.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s", strings.TrimRight(s.opts.Address, "/"), strings.TrimLeft(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+
+	if err != nil {
+		return err
+	}
+
+	if len(s.token) > 0 {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+
+	if len(s.opts.Namespace) > 0 {
+		req.Header.Set("X-Vault-Namespace", s.opts.Namespace)
+	}
+
+	res, err := s.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		vaultErr := VaultError{StatusCode: res.StatusCode}
+		_ = json.NewDecoder(res.Body).Decode(&vaultErr)
+
+		return vaultErr
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// setToken records the token of an auth response along with its lease
+func (s *VaultSource) setToken(auth *vaultAuth) error {
+	if auth == nil || len(auth.ClientToken) == 0 {
+		return errors.New("vault: the response holds no token")
+	}
+
+	s.token = auth.ClientToken
+	s.setLease(auth.LeaseDuration, auth.Renewable)
+
+	return nil
+}
+
+// setLease schedules the renewal of the token once two thirds of its lease have elapsed, leaving time to retry
+func (s *VaultSource) setLease(seconds int, renewable bool) {
+	s.renewable = renewable
+	s.renewAt = time.Time{}
+	s.renewFailures = 0
+
+	if seconds > 0 {
+		s.renewAt = time.Now().Add(time.Duration(seconds) * time.Second * 2 / 3)
+	}
+}
+
+// login logs in with AppRole, or looks up the lease of the configured token
+func (s *VaultSource) login(ctx context.Context) error {
+	var res vaultResponse
+
+	if !s.usesAppRole() {
+		s.token = s.opts.Token
+
+		// tokens which aren't allowed to look themselves up are simply never renewed
+		if err := s.request(ctx, http.MethodGet, "auth/token/lookup-self", nil, &res); err != nil {
+			return nil
+		}
+
+		var data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		}
+
+		if err := json.Unmarshal(res.Data, &data); err == nil {
+			s.setLease(data.TTL, data.Renewable)
+		}
+
+		return nil
+	}
+
+	body := map[string]string{"role_id": s.opts.RoleID, "secret_id": s.opts.SecretID}
+	err := s.request(ctx, http.MethodPost, fmt.Sprintf("auth/%s/login", stringOrDefault(s.opts.RoleMount, "approle")), body, &res)
+
+	if err != nil {
+		return err
+	}
+
+	return s.setToken(res.Auth)
+}
+
+// RenewToken extends the lease of the token, logging in again with AppRole when it can't be renewed
+func (s *VaultSource) RenewToken(ctx context.Context) error {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	if s.renewable {
+		var res vaultResponse
+
+		err := s.request(ctx, http.MethodPost, "auth/token/renew-self", nil, &res)
+
+		if err == nil {
+			err = s.setToken(res.Auth)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if !s.usesAppRole() {
+			s.retryRenewal()
+
+			return err
+		}
+	}
+
+	if !s.usesAppRole() {
+		// the token can't be replaced either, so it's left to expire
+		s.renewAt = time.Time{}
+
+		return errors.New("vault: the token is not renewable")
+	}
+
+	if err := s.login(ctx); err != nil {
+		s.retryRenewal()
+
+		return err
+	}
+
+	return nil
+}
+
+// retryRenewal schedules another renewal after a failed one, backing off exponentially
+func (s *VaultSource) retryRenewal() {
+	backoff := maxVaultRenewalBackoff
+
+	if s.renewFailures < 6 {
+		backoff = time.Second << s.renewFailures
+	}
+
+	s.renewFailures++
+	s.renewAt = time.Now().Add(backoff)
+}
+
+// Fetch reads the secret, and reports whether its version changed since the last fetch
+func (s *VaultSource) Fetch(ctx context.Context) (bool, error) {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+
+	if len(s.token) == 0 {
+		if err := s.login(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	var res vaultResponse
+
+	path := fmt.Sprintf("%s/data/%s", strings.Trim(stringOrDefault(s.opts.Mount, "secret"), "/"), strings.Trim(s.opts.Path, "/"))
+	err := s.request(ctx, http.MethodGet, path, nil, &res)
+
+	var vaultErr VaultError
+
+	// the AppRole token may have expired while the application wasn't watching the source
+	if errors.As(err, &vaultErr) && vaultErr.StatusCode == http.StatusForbidden && s.usesAppRole() {
+		if err = s.login(ctx); err != nil {
+			return false, err
+		}
+
+		err = s.request(ctx, http.MethodGet, path, nil, &res)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var secret struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	}
+
+	if err = json.Unmarshal(res.Data, &secret); err != nil {
+		return false, err
+	}
+
+	if secret.Metadata.Version > 0 && secret.Metadata.Version == s.version {
+		return false, nil
+	}
+
+	normalizer, err := s.registry.NormalizerForSourceType(s.opts.Convention, VaultSourceType)
+
+	if err != nil {
+		return false, err
+	}
+
+	data := secret.Data
+
+	if len(s.opts.KeyPrefix) > 0 {
+		data = make(map[string]interface{})
+		setTreeValue(data, strings.Split(normalizer.Normalize(s.opts.KeyPrefix), "."), secret.Data)
+	}
+
+	source, err := newMapSource(s.registry, VaultSourceType, data, s.opts.Convention)
+
+	if err != nil {
+		return false, err
+	}
+
+	source.strict = s.opts.Strict
+	source.fuzzy = s.opts.FuzzyKeys
+
+	s.swap(source)
+	s.version = secret.Metadata.Version
+
+	return true, nil
+}
+
+// Watch polls the secret, and renews the lease of the token before it expires
+func (s *VaultSource) Watch(ctx context.Context, onChange func(err error)) error {
+	interval := s.opts.PollInterval
+
+	if interval <= 0 {
+		interval = defaultVaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var renew <-chan time.Time
+
+		s.fetching.Lock()
+		renewAt := s.renewAt
+		s.fetching.Unlock()
+
+		if !renewAt.IsZero() {
+			renew = time.After(time.Until(renewAt))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-renew:
+			if err := s.RenewToken(ctx); err != nil && ctx.Err() == nil {
+				onChange(err)
+			}
+		case <-ticker.C:
+			changed, err := s.Fetch(ctx)
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if err != nil || changed {
+				onChange(err)
+			}
+		}
+	}
+}
+
+// NewVaultSource is like NewVaultSourceContext, without a deadline for the first fetch
+func NewVaultSource(opts VaultSourceOptions) (*VaultSource, error) {
+	return NewVaultSourceContext(context.Background(), opts)
+}
+
+// NewVaultSourceContext logs in and reads the secret once, failing if it can't be read
+func NewVaultSourceContext(ctx context.Context, opts VaultSourceOptions) (*VaultSource, error) {
+	if len(opts.Address) == 0 {
+		opts.Address = "https://127.0.0.1:8200"
+	}
+
+	if len(opts.Token) == 0 && len(opts.RoleID) == 0 {
+		return nil, errors.New("vault: either a token or an AppRole role ID is required")
+	}
+
+	client := opts.Client
+
+	if client == nil {
+		client = newRemoteClient(opts.RootCAs, 30*time.Second)
+	}
+
+	source := &VaultSource{
+		remoteSource: remoteSource{typ: VaultSourceType, registry: registryOrDefault(opts.Registry)},
+		opts:         opts,
+		client:       client,
+	}
+
+	if _, err := source.Fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// BuildVaultSource is like BuildVaultSourceContext, without a deadline for the first fetch
+func BuildVaultSource(opts SourceOptions) (Source, error) {
+	return BuildVaultSourceContext(context.Background(), opts)
+}
+
+// BuildVaultSourceContext reads the mount and the path of the secret from a file path such as vault://vault.internal:8200/secret/myapp,
+// where the host may be left out to use VAULT_ADDR, and the key prefix from its "prefix" parameter.
+// The credentials are read from VAULT_TOKEN, or VAULT_ROLE_ID and VAULT_SECRET_ID,
+// along with VAULT_NAMESPACE, VAULT_CACERT and CONFIG_VAULT_POLL_INTERVAL
+func BuildVaultSourceContext(ctx context.Context, opts SourceOptions) (Source, error) {
+	u, err := url.Parse(opts.FilePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != VaultSourceType {
+		return nil, errors.New("the file path of a vault source must be a vault:// URL")
+	}
+
+	mount, path, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+
+	vaultOpts := VaultSourceOptions{
+		Address:    os.Getenv("VAULT_ADDR"),
+		Mount:      mount,
+		Path:       path,
+		KeyPrefix:  u.Query().Get("prefix"),
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		Convention: opts.Convention,
+		Strict:     opts.Strict,
+		FuzzyKeys:  opts.FuzzyKeys,
+		Registry:   opts.Registry,
+		Token:      os.Getenv("VAULT_TOKEN"),
+		RoleID:     os.Getenv("VAULT_ROLE_ID"),
+		SecretID:   os.Getenv("VAULT_SECRET_ID"),
+	}
+
+	if len(u.Host) > 0 {
+		vaultOpts.Address = "https://" + u.Host
+	}
+
+	if interval := os.Getenv("CONFIG_VAULT_POLL_INTERVAL"); len(interval) > 0 {
+		vaultOpts.PollInterval, err = time.ParseDuration(interval)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if caFile := os.Getenv("VAULT_CACERT"); len(caFile) > 0 {
+		if vaultOpts.RootCAs, err = loadRootCAs(caFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewVaultSourceContext(ctx, vaultOpts)
+}
@@ -0,0 +1,309 @@
+package confusing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vaultTestServer serves a KV v2 secret along with the token and AppRole endpoints, expiring tokens on demand
+type vaultTestServer struct {
+	mutex    sync.Mutex
+	data     map[string]interface{}
+	version  int
+	roleID   string
+	secretID string
+	// token accepted by the server, which is issued by AppRole logins when roleID is set
+	token string
+	// lease of the tokens, in seconds
+	lease      int
+	renewable  bool
+	renewFails bool
+	logins     int
+	renewals   int
+}
+
+func newVaultTestServer(data map[string]interface{}) *vaultTestServer {
+	return &vaultTestServer{data: data, version: 1}
+}
+
+func (s *vaultTestServer) set(data map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = data
+	s.version++
+}
+
+func (s *vaultTestServer) expireToken() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.token = ""
+}
+
+func (s *vaultTestServer) counts() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.logins, s.renewals
+}
+
+func (s *vaultTestServer) auth() map[string]interface{} {
+	return map[string]interface{}{"client_token": s.token, "lease_duration": s.lease, "renewable": s.renewable}
+}
+
+func (s *vaultTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	writeError := func(status int, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["role_id"] != s.roleID || body["secret_id"] != s.secretID {
+			writeError(http.StatusBadRequest, "invalid role or secret ID")
+
+			return
+		}
+
+		s.logins++
+		s.token = "token" + strconv.Itoa(s.logins)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": s.auth()})
+
+		return
+	}
+
+	if len(s.token) == 0 || r.Header.Get("X-Vault-Token") != s.token {
+		writeError(http.StatusForbidden, "permission denied")
+
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"ttl": s.lease, "renewable": s.renewable}})
+	case "/v1/auth/token/renew-self":
+		s.renewals++
+
+		if s.renewFails {
+			writeError(http.StatusInternalServerError, "internal error")
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": s.auth()})
+	case "/v1/secret/data/myapp":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     s.data,
+				"metadata": map[string]int{"version": s.version},
+			},
+		})
+	default:
+		writeError(http.StatusNotFound, "not found")
+	}
+}
+
+type vaultTestConfig struct {
+	Database struct {
+		Username string
+		Password string
+	}
+}
+
+func TestVaultSourceAppRole(t *testing.T) {
+	handler := newVaultTestServer(map[string]interface{}{"username": "jackie", "password": "secret"})
+	handler.roleID, handler.secretID = "role", "secret"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	opts := VaultSourceOptions{Address: server.URL, Path: "myapp", KeyPrefix: "database", RoleID: "role", SecretID: "wrong"}
+
+	if _, err := NewVaultSource(opts); err == nil {
+		t.Error("expected a wrong secret ID to be reported")
+	}
+
+	opts.SecretID = "secret"
+	source, err := NewVaultSource(opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config vaultTestConfig
+
+	if err = source.Read(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Database.Username != "jackie" || config.Database.Password != "secret" {
+		t.Errorf("got %+v", config)
+	}
+
+	// the token expired while the source wasn't watched, so it logs in again
+	handler.expireToken()
+	handler.set(map[string]interface{}{"username": "jackie", "password": "rotated"})
+
+	changed, err := source.Fetch(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var password string
+
+	if err = source.ReadKey("database.password", &password); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins, _ := handler.counts(); !changed || password != "rotated" || logins != 2 {
+		t.Errorf("expected the secret to be read after logging in again, changed: %v, password: %s, logins: %d", changed, password, logins)
+	}
+}
+
+func TestVaultSourceFetch(t *testing.T) {
+	handler := newVaultTestServer(map[string]interface{}{"password": "secret"})
+	handler.token = "static"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewVaultSource(VaultSourceOptions{Address: server.URL, Path: "myapp", Token: "static"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the version didn't change
+	changed, err := source.Fetch(context.Background())
+
+	if err != nil || changed {
+		t.Errorf("expected the secret to be unchanged, changed: %v, error: %v", changed, err)
+	}
+
+	handler.set(map[string]interface{}{"password": "rotated"})
+
+	if changed, err = source.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := Get[string](source, "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || password != "rotated" {
+		t.Errorf("expected the new version to be read, changed: %v, password: %s", changed, password)
+	}
+}
+
+func TestVaultSourceWatch(t *testing.T) {
+	handler := newVaultTestServer(map[string]interface{}{"password": "secret"})
+	handler.token = "static"
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewVaultSource(VaultSourceOptions{Address: server.URL, Path: "myapp", Token: "static", PollInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	changes := make(chan error, 1)
+	done := make(chan error)
+
+	go func() {
+		done <- source.Watch(ctx, func(err error) {
+			changes <- err
+		})
+	}()
+
+	handler.set(map[string]interface{}{"password": "rotated"})
+
+	select {
+	case err = <-changes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the change wasn't reported")
+	}
+
+	if password := MustGet[string](source, "password"); password != "rotated" {
+		t.Errorf("expected rotated, got %s", password)
+	}
+
+	cancel()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to return context.Canceled, got %v", err)
+	}
+}
+
+func TestVaultSourceRenewToken(t *testing.T) {
+	handler := newVaultTestServer(map[string]interface{}{"password": "secret"})
+	handler.token, handler.lease, handler.renewable = "static", 1, true
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	source, err := NewVaultSource(VaultSourceOptions{Address: server.URL, Path: "myapp", Token: "static", PollInterval: time.Minute})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var errorsMutex sync.Mutex
+	var errs []error
+	done := make(chan error)
+
+	go func() {
+		done <- source.Watch(ctx, func(err error) {
+			errorsMutex.Lock()
+			defer errorsMutex.Unlock()
+
+			errs = append(errs, err)
+		})
+	}()
+
+	// the token is renewed once two thirds of its lease have elapsed
+	time.Sleep(time.Second)
+
+	if _, renewals := handler.counts(); renewals != 1 {
+		t.Errorf("expected the token to be renewed once, got %d renewals", renewals)
+	}
+
+	handler.mutex.Lock()
+	handler.renewFails = true
+	handler.mutex.Unlock()
+
+	// the failed renewal is retried after a second, rather than right away
+	time.Sleep(1800 * time.Millisecond)
+	cancel()
+
+	if err = <-done; err != context.Canceled {
+		t.Errorf("expected Watch to return context.Canceled, got %v", err)
+	}
+
+	errorsMutex.Lock()
+	defer errorsMutex.Unlock()
+
+	if _, renewals := handler.counts(); renewals != 3 || len(errs) != 2 {
+		t.Errorf("expected the failed renewal to be retried once, got %d renewals and errors %v", renewals, errs)
+	}
+}
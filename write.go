@@ -0,0 +1,192 @@
+package confusing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var NoFilePathError = errors.New("source wasn't read from a file")
+
+func (s *MapSource) Set(key string, value interface{}) error {
+	if key == "" {
+		return errors.New("key must not be empty")
+	}
+
+	parts := strings.Split(s.normalizer.Normalize(key), ".")
+
+	if s.node != nil {
+		if err := s.setYAMLNode(key, parts, value); err != nil {
+			return err
+		}
+
+		return s.decodeYAMLNode()
+	}
+
+	if s.data == nil {
+		s.data = make(map[string]interface{})
+	}
+
+	m := s.data
+
+	for i, part := range parts[:len(parts)-1] {
+		child, ok := m[part]
+
+		if !ok || child == nil {
+			child = make(map[string]interface{})
+			m[part] = child
+		}
+
+		childMap, ok := child.(map[string]interface{})
+
+		if !ok {
+			return fmt.Errorf("can't set %s: %s is not a map", key, strings.Join(parts[:i+1], "."))
+		}
+
+		m = childMap
+	}
+
+	m[parts[len(parts)-1]] = value
+
+	return s.encodeJSONPositions()
+}
+
+func (s *MapSource) Delete(key string) error {
+	if key == "" {
+		return errors.New("key must not be empty")
+	}
+
+	parts := strings.Split(s.normalizer.Normalize(key), ".")
+
+	if s.node != nil {
+		if err := s.deleteYAMLNode(key, parts); err != nil {
+			return err
+		}
+
+		return s.decodeYAMLNode()
+	}
+
+	m := s.data
+
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := m[part].(map[string]interface{})
+
+		if !ok {
+			return KeyNotFoundError{Key: key}
+		}
+
+		m = child
+	}
+
+	last := parts[len(parts)-1]
+
+	if _, ok := m[last]; !ok {
+		return KeyNotFoundError{Key: key}
+	}
+
+	delete(m, last)
+
+	return s.encodeJSONPositions()
+}
+
+// Save encodes the data in the format of the source, and replaces the file by renaming a temporary file over it
+// The permissions of the file are preserved, and so are the comments, ordering, anchors and styles of YAML files
+func (s *MapSource) Save() error {
+	if s.filePath == "" {
+		return NoFilePathError
+	}
+
+	var data []byte
+	var err error
+
+	if s.node != nil {
+		data, err = encodeYAMLNode(s.node)
+	} else {
+		data, err = (&Document{Type: s.typ, Data: s.data}).Encode()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.filePath, data)
+}
+
+// decodeYAMLNode refreshes the data after the node was modified, which also resolves aliases to modified anchors
+func (s *MapSource) decodeYAMLNode() error {
+	var data map[string]interface{}
+
+	if err := s.node.Decode(&data); err != nil {
+		return err
+	}
+
+	s.data = data
+	s.positions = yamlPositions(s.filePath, s.node)
+
+	return nil
+}
+
+// encodeJSONPositions refreshes the positions of the keys of a JSON file after the data was modified, pointing at the
+// keys as they're written by Save, since the positions of the file as it was read no longer match the data
+func (s *MapSource) encodeJSONPositions() error {
+	if s.typ != JSONSourceType || s.filePath == "" {
+		return nil
+	}
+
+	data, err := (&Document{Type: s.typ, Data: s.data}).Encode()
+
+	if err != nil {
+		return err
+	}
+
+	s.positions, err = jsonPositions(s.filePath, data)
+
+	return err
+}
+
+func writeFileAtomic(filePath string, data []byte) error {
+	perm := os.FileMode(0644)
+
+	if info, err := os.Stat(filePath); err == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tempPath := file.Name()
+
+	// once renamed, there is nothing left to remove
+	defer os.Remove(tempPath)
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err = file.Chmod(perm); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, filePath)
+}
@@ -0,0 +1,60 @@
+package confusing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapSourceSetJSONPositions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "config.json")
+
+	if err := os.WriteFile(filePath, []byte("{\n  \"welcomeMessage\": \"hi\",\n  \"database\": {\"host\": \"db1\", \"port\": 5432}\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := BuildJSONSource(SourceOptions{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writable := source.(WritableSource)
+
+	if err = writable.Delete("welcomeMessage"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = writable.Set("database.port", "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Database struct {
+			Host string
+			Port int
+		}
+	}
+
+	var decodeErr DecodeError
+
+	if err = source.Read(&config); !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a DecodeError, got %v", err)
+	}
+
+	if err = writable.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := BuildJSONSource(SourceOptions{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the error points at the key as it's written by Save
+	if position, _ := saved.(*MapSource).Position("database.port"); decodeErr.Position != position {
+		t.Errorf("expected the error to be reported at %s, got %s", position, decodeErr.Position)
+	}
+}
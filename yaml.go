@@ -0,0 +1,219 @@
+package confusing
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// resolveYAMLAlias follows aliases to the node they refer to
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node
+}
+
+// yamlMappingIndex returns the index of the key node of key in a mapping node, or -1 if it doesn't exist
+func yamlMappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// yamlRoot returns the top-level mapping of the document, creating it if the document is empty
+func (s *MapSource) yamlRoot() (*yaml.Node, error) {
+	if s.node.Kind != yaml.DocumentNode {
+		*s.node = yaml.Node{Kind: yaml.DocumentNode}
+	}
+
+	if len(s.node.Content) == 0 {
+		s.node.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	root := resolveYAMLAlias(s.node.Content[0])
+
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the document is not a map")
+	}
+
+	return root, nil
+}
+
+// yamlKeyNode returns the key node of the normalized key, and the mapping node holding it
+func (s *MapSource) yamlKeyNode(parts []string) (*yaml.Node, *yaml.Node) {
+	if s.node == nil || len(s.node.Content) == 0 {
+		return nil, nil
+	}
+
+	m := resolveYAMLAlias(s.node.Content[0])
+
+	for i, part := range parts {
+		if m.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+
+		index := yamlMappingIndex(m, part)
+
+		if index < 0 {
+			return nil, nil
+		}
+
+		if i == len(parts)-1 {
+			return m.Content[index], m
+		}
+
+		m = resolveYAMLAlias(m.Content[index+1])
+	}
+
+	return nil, nil
+}
+
+// setYAMLNode replaces the value at the normalized key, creating the intermediate mappings as needed
+// The comments, anchor and, when the type of the value doesn't change, the quoting style of the previous value are preserved
+// Setting a key below an alias modifies the anchored value
+func (s *MapSource) setYAMLNode(key string, parts []string, value interface{}) error {
+	m, err := s.yamlRoot()
+
+	if err != nil {
+		return err
+	}
+
+	var valueNode yaml.Node
+
+	if err = valueNode.Encode(value); err != nil {
+		return err
+	}
+
+	for i, part := range parts {
+		index := yamlMappingIndex(m, part)
+
+		if index < 0 {
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+			m.Content = append(m.Content, keyNode, child)
+			index = len(m.Content) - 2
+		}
+
+		if i == len(parts)-1 {
+			previous := m.Content[index+1]
+
+			if previous.Kind == valueNode.Kind && previous.Tag == valueNode.Tag {
+				valueNode.Style = previous.Style
+			}
+
+			valueNode.Anchor = previous.Anchor
+			valueNode.HeadComment = previous.HeadComment
+			valueNode.LineComment = previous.LineComment
+			valueNode.FootComment = previous.FootComment
+
+			// the node is updated in place, since aliases of an anchored value point at it
+			*previous = valueNode
+
+			return nil
+		}
+
+		child := resolveYAMLAlias(m.Content[index+1])
+
+		if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("can't set %s: %s is not a map", key, strings.Join(parts[:i+1], "."))
+		}
+
+		m = child
+	}
+
+	return nil
+}
+
+// deleteYAMLNode removes the normalized key along with its comments
+func (s *MapSource) deleteYAMLNode(key string, parts []string) error {
+	keyNode, m := s.yamlKeyNode(parts)
+
+	if keyNode == nil {
+		return KeyNotFoundError{Key: key}
+	}
+
+	index := yamlMappingIndex(m, keyNode.Value)
+	m.Content = append(m.Content[:index], m.Content[index+2:]...)
+
+	return nil
+}
+
+// yamlIndent guesses the indentation of the document from its first nested mapping, defaulting to 2 spaces
+func yamlIndent(node *yaml.Node) int {
+	var find func(node *yaml.Node) int
+
+	find = func(node *yaml.Node) int {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				if indent := find(child); indent > 0 {
+					return indent
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				value := node.Content[i+1]
+
+				if value.Kind == yaml.MappingNode && len(value.Content) > 0 && value.Content[0].Line > node.Content[i].Line {
+					return value.Content[0].Column - node.Content[i].Column
+				}
+
+				if indent := find(value); indent > 0 {
+					return indent
+				}
+			}
+		case yaml.SequenceNode:
+			for _, child := range node.Content {
+				if indent := find(child); indent > 0 {
+					return indent
+				}
+			}
+		}
+
+		return 0
+	}
+
+	if indent := find(node); indent > 0 {
+		return indent
+	}
+
+	return 2
+}
+
+// untagYAMLMergeKeys clears the tag of merge keys, which yaml.v3 would otherwise write as "!!merge <<"
+func untagYAMLMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!merge" {
+		node.Tag = ""
+	}
+
+	for _, child := range node.Content {
+		untagYAMLMergeKeys(child)
+	}
+}
+
+func encodeYAMLNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+
+	untagYAMLMergeKeys(node)
+
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(yamlIndent(node))
+
+	if err := e.Encode(node); err != nil {
+		return nil, err
+	}
+
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}